@@ -1,5 +1,10 @@
 $Targets = @("linux/amd64", "windows/amd64")
 $OutputDir = ".\build"
+$Version = git describe --tags --always --dirty 2>$null
+if (-not $Version) {
+    $Version = "dev"
+}
+$LdFlags = "-X ic/shared.Version=$Version"
 
 New-Item -ItemType Directory -Force -Path $OutputDir
 
@@ -20,21 +25,42 @@ foreach ($Target in $Targets) {
     Write-Host "Building compare..."
     $Env:GOOS = $OS
     $Env:GOARCH = $Arch
-    go build -o "../../$OutputDir/$OSArch/Compare$Extension"
+    go build -ldflags $LdFlags -o "../../$OutputDir/$OSArch/Compare$Extension"
     Pop-Location
 
     Push-Location ./filter/src
     Write-Host "Building filter..."
     $Env:GOOS = $OS
     $Env:GOARCH = $Arch
-    go build -o "../../$OutputDir/$OSArch/Filter$Extension"
+    go build -ldflags $LdFlags -o "../../$OutputDir/$OSArch/Filter$Extension"
     Pop-Location
 
     Push-Location ./browser/src
     Write-Host "Building browser..."
     $Env:GOOS = $OS
     $Env:GOARCH = $Arch
-    go build -o "../../$OutputDir/$OSArch/Browser$Extension"
+    go build -ldflags $LdFlags -o "../../$OutputDir/$OSArch/Browser$Extension"
+    Pop-Location
+
+    Push-Location ./report/src
+    Write-Host "Building report..."
+    $Env:GOOS = $OS
+    $Env:GOARCH = $Arch
+    go build -ldflags $LdFlags -o "../../$OutputDir/$OSArch/Report$Extension"
+    Pop-Location
+
+    Push-Location ./approve/src
+    Write-Host "Building approve..."
+    $Env:GOOS = $OS
+    $Env:GOARCH = $Arch
+    go build -ldflags $LdFlags -o "../../$OutputDir/$OSArch/Approve$Extension"
+    Pop-Location
+
+    Push-Location ./serve/src
+    Write-Host "Building serve..."
+    $Env:GOOS = $OS
+    $Env:GOARCH = $Arch
+    go build -ldflags $LdFlags -o "../../$OutputDir/$OSArch/Serve$Extension"
     Pop-Location
 }
 
@@ -4,6 +4,8 @@ set -e
 TARGETS=("linux/amd64" "windows/amd64")
 
 OUTPUT_DIR="./build"
+VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo dev)
+LDFLAGS="-X ic/shared.Version=$VERSION"
 mkdir -p $OUTPUT_DIR
 
 for TARGET in "${TARGETS[@]}"; do
@@ -18,15 +20,27 @@ for TARGET in "${TARGETS[@]}"; do
 
     cd compare/src
     echo "Building compare..."
-    GOOS=$OS GOARCH=$ARCH go build -o ../../$OUTPUT_DIR/$OSARCH/Compare$EXTENSION
+    GOOS=$OS GOARCH=$ARCH go build -ldflags "$LDFLAGS" -o ../../$OUTPUT_DIR/$OSARCH/Compare$EXTENSION
     cd ../..
     cd filter/src
     echo "Building filter..."
-    GOOS=$OS GOARCH=$ARCH go build -o ../../$OUTPUT_DIR/$OSARCH/Filter$EXTENSION
+    GOOS=$OS GOARCH=$ARCH go build -ldflags "$LDFLAGS" -o ../../$OUTPUT_DIR/$OSARCH/Filter$EXTENSION
     cd ../..
     cd browser/src
     echo "Building browser..."
-    GOOS=$OS GOARCH=$ARCH go build -o ../../$OUTPUT_DIR/$OSARCH/Browser$EXTENSION
+    GOOS=$OS GOARCH=$ARCH go build -ldflags "$LDFLAGS" -o ../../$OUTPUT_DIR/$OSARCH/Browser$EXTENSION
+    cd ../..
+    cd report/src
+    echo "Building report..."
+    GOOS=$OS GOARCH=$ARCH go build -ldflags "$LDFLAGS" -o ../../$OUTPUT_DIR/$OSARCH/Report$EXTENSION
+    cd ../..
+    cd approve/src
+    echo "Building approve..."
+    GOOS=$OS GOARCH=$ARCH go build -ldflags "$LDFLAGS" -o ../../$OUTPUT_DIR/$OSARCH/Approve$EXTENSION
+    cd ../..
+    cd serve/src
+    echo "Building serve..."
+    GOOS=$OS GOARCH=$ARCH go build -ldflags "$LDFLAGS" -o ../../$OUTPUT_DIR/$OSARCH/Serve$EXTENSION
     cd ../..
 done
 
@@ -0,0 +1,9 @@
+module ic/approve
+
+go 1.21.0
+
+replace ic/shared => ../shared
+
+require ic/shared v0.0.0-00010101000000-000000000000
+
+require golang.org/x/image v0.23.0 // indirect
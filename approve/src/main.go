@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"ic/shared"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ApproveArgs struct {
+	Root       string
+	Directory  string
+	List       string
+	OnlyFailed bool
+	DryRun     bool
+	Log        string
+}
+
+// Approval is one line of the audit log.
+type Approval struct {
+	Time      string `json:"time"`
+	Location  string `json:"location"`
+	Source    string `json:"source"`
+	Target    string `json:"target"`
+	OldSHA256 string `json:"old_sha256"`
+	NewSHA256 string `json:"new_sha256"`
+}
+
+func validateArgs(args []string) (ApproveArgs, error) {
+	fs := flag.NewFlagSet("approve", flag.ContinueOnError)
+
+	root := fs.String("A", "", "Directory with the golden A images, every replaced file must be inside it.")
+	d := fs.String("d", "", "Path to directory with comparison results.")
+	l := fs.String("l", "", "Optional: File with one result location per line, as printed by filter, - for stdin.")
+	failed := fs.Bool("failed", false, "Optional: Only approve pairs that did not pass.")
+	dryRun := fs.Bool("dry-run", false, "Optional: Print what would be approved without changing files.")
+	logPath := fs.String("log", "", "Optional: Audit log the approvals are appended to, defaults to approve.log in the results directory.")
+
+	if err := fs.Parse(args); err != nil {
+		return ApproveArgs{}, err
+	}
+
+	if (len(*d) == 0) == (len(*l) == 0) {
+		return ApproveArgs{}, fmt.Errorf("provide either a results directory or a location list")
+	}
+
+	if len(*d) > 0 {
+		info, err := os.Stat(*d)
+		if err != nil || !info.IsDir() {
+			return ApproveArgs{}, fmt.Errorf("no results directory provided")
+		}
+	}
+
+	info, err := os.Stat(*root)
+	if err != nil || !info.IsDir() {
+		return ApproveArgs{}, fmt.Errorf("no golden directory A provided")
+	}
+
+	if len(*logPath) == 0 {
+		if len(*d) == 0 && !*dryRun {
+			return ApproveArgs{}, fmt.Errorf("a location list needs -log")
+		}
+		*logPath = filepath.Join(*d, "approve.log")
+	}
+
+	return ApproveArgs{Root: *root, Directory: *d, List: *l, OnlyFailed: *failed, DryRun: *dryRun, Log: *logPath}, nil
+}
+
+func readList(path string, stdin io.Reader) ([]shared.Comparison, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	comparisons := []shared.Comparison{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		location := strings.TrimSpace(scanner.Text())
+		if len(location) == 0 {
+			continue
+		}
+
+		c, err := shared.ReadMetaFile(filepath.Join(location, "meta.json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", location, err)
+		}
+		comparisons = append(comparisons, c)
+	}
+
+	return comparisons, scanner.Err()
+}
+
+func hashIfExists(path string) (string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+	return shared.HashFile(path)
+}
+
+// insideRoot reports whether path is inside root once symlinks of root and
+// of the existing directories of path are resolved.
+func insideRoot(root string, path string) bool {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+
+	dir := filepath.Dir(path)
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			rest, _ := filepath.Rel(dir, path)
+			path = filepath.Join(resolved, rest)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// extFormats maps file extensions to the decoder names of shared.
+var extFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".tif":  "tiff",
+	".tiff": "tiff",
+}
+
+func extFormat(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if format, ok := extFormats[ext]; ok {
+		return format
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// approve copies source B over source A, the returned approval is nil when
+// they are already identical. A has to be inside root and B has to be in the
+// format A's extension names, pairs of different formats are not copied.
+func approve(c shared.Comparison, root string, dryRun bool, out io.Writer) (*Approval, error) {
+	if len(c.SourceAPath) == 0 || len(c.SourceBPath) == 0 {
+		return nil, fmt.Errorf("%s: meta.json has no source paths, rerun compare", c.Dir)
+	}
+
+	if !insideRoot(root, c.SourceAPath) {
+		return nil, fmt.Errorf("%s: %s is not inside %s", c.Dir, c.SourceAPath, root)
+	}
+
+	_, info, err := shared.ReadImageInfo(c.SourceBPath, shared.LoadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if info.Format != extFormat(c.SourceAPath) {
+		return nil, fmt.Errorf("%s: %s is %s, it can't replace %s", c.Dir, c.SourceBPath, info.Format, c.SourceAPath)
+	}
+
+	oldHash, err := hashIfExists(c.SourceAPath)
+	if err != nil {
+		return nil, err
+	}
+	newHash, err := shared.HashFile(c.SourceBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldHash == newHash {
+		fmt.Fprintf(out, "unchanged %s\n", c.SourceAPath)
+		return nil, nil
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "would replace %s with %s\n", c.SourceAPath, c.SourceBPath)
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.SourceBPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.SourceAPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := shared.WriteFileAtomic(c.SourceAPath, data); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "replaced %s with %s\n", c.SourceAPath, c.SourceBPath)
+
+	return &Approval{
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		Location:  c.Dir,
+		Source:    c.SourceBPath,
+		Target:    c.SourceAPath,
+		OldSHA256: oldHash,
+		NewSHA256: newHash,
+	}, nil
+}
+
+func run(args []string, stdin io.Reader, out io.Writer) error {
+	approveArgs, err := validateArgs(args)
+	if err != nil {
+		return err
+	}
+
+	var comparisons []shared.Comparison
+	if len(approveArgs.Directory) > 0 {
+		comparisons = shared.FindMetaFiles(approveArgs.Directory)
+	} else if comparisons, err = readList(approveArgs.List, stdin); err != nil {
+		return err
+	}
+
+	var logFile *os.File
+	if !approveArgs.DryRun {
+		logFile, err = os.OpenFile(approveArgs.Log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+	}
+
+	// Every approval is logged as soon as the file is replaced so an
+	// interrupted run still leaves an accurate audit log.
+	for _, c := range comparisons {
+		if approveArgs.OnlyFailed && c.Passed {
+			continue
+		}
+		// There is nothing to approve for a file only on one side.
+		if len(c.OnlyIn) > 0 {
+			fmt.Fprintf(out, "skipped %s, only in %s\n", c.Dir, c.OnlyIn)
+			continue
+		}
+
+		a, err := approve(c, approveArgs.Root, approveArgs.DryRun, out)
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			continue
+		}
+
+		line, err := json.Marshal(a)
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		if _, err := logFile.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("error writing to file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
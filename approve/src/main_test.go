@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"ic/shared"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func copyAsset(t *testing.T, asset string, path string) {
+	writeFile(t, path, readFile(t, filepath.Join("../../testAssets", asset)))
+}
+
+func writeMeta(t *testing.T, dir string, comparison shared.Comparison) {
+	data, _ := json.Marshal(comparison)
+	writeFile(t, filepath.Join(dir, "meta.json"), string(data))
+}
+
+// setup creates a failing and a passing pair and returns the golden and
+// results directories and the golden path of the failing pair.
+func setup(t *testing.T) (string, string, string) {
+	root := t.TempDir()
+
+	failA := filepath.Join(root, "A", "icons", "red.png")
+	failB := filepath.Join(root, "B", "icons", "red.png")
+	passA := filepath.Join(root, "A", "blue.png")
+	passB := filepath.Join(root, "B", "blue.png")
+
+	copyAsset(t, "white.png", failA)
+	copyAsset(t, "red.png", failB)
+	copyAsset(t, "blue.png", passA)
+	copyAsset(t, "black.png", passB)
+
+	results := filepath.Join(root, "results")
+	writeMeta(t, filepath.Join(results, "icons", "red"), shared.Comparison{SourceAPath: failA, SourceBPath: failB, Passed: false})
+	writeMeta(t, filepath.Join(results, "blue"), shared.Comparison{SourceAPath: passA, SourceBPath: passB, Passed: true})
+
+	return filepath.Join(root, "A"), results, failA
+}
+
+func TestDryRun(t *testing.T) {
+	goldens, results, golden := setup(t)
+	logPath := filepath.Join(t.TempDir(), "approve.log")
+
+	var out bytes.Buffer
+	if err := run([]string{"-A", goldens, "-d", results, "-dry-run", "-log", logPath}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if readFile(t, golden) != readFile(t, "../../testAssets/white.png") {
+		t.Errorf("Dry run test failed, golden image was replaced")
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("Dry run test failed, audit log was written")
+	}
+	if strings.Count(out.String(), "would replace") != 2 {
+		t.Errorf("Dry run test failed, expected two planned approvals, got:\n%s", out.String())
+	}
+}
+
+func TestApproveFailed(t *testing.T) {
+	goldens, results, golden := setup(t)
+	logPath := filepath.Join(t.TempDir(), "approve.log")
+	if err := os.Chmod(golden, 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeMeta(t, filepath.Join(results, "new"), shared.Comparison{SourceB: "new.png", OnlyIn: "B"})
+
+	out := &bytes.Buffer{}
+	if err := run([]string{"-A", goldens, "-d", results, "-failed", "-log", logPath}, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "only in B") {
+		t.Errorf("Approve test failed, file only in B was not skipped:\n%s", out)
+	}
+
+	if readFile(t, golden) != readFile(t, "../../testAssets/red.png") {
+		t.Errorf("Approve test failed, golden image was not replaced")
+	}
+	if info, err := os.Stat(golden); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Approve test failed, golden image mode changed (%v)", err)
+	}
+	if readFile(t, filepath.Join(goldens, "blue.png")) != readFile(t, "../../testAssets/blue.png") {
+		t.Errorf("Approve test failed, passing pair was approved")
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a Approval
+	if err := json.Unmarshal(bytes.TrimSpace(data), &a); err != nil {
+		t.Fatalf("Approve test failed, expected one log entry, got:\n%s", data)
+	}
+
+	hash, _ := shared.HashFile(golden)
+	if a.Target != golden || a.NewSHA256 != hash || a.OldSHA256 == hash || len(a.Time) == 0 {
+		t.Errorf("Approve test failed, unexpected log entry %+v", a)
+	}
+}
+
+func TestApproveList(t *testing.T) {
+	goldens, results, golden := setup(t)
+	logPath := filepath.Join(t.TempDir(), "approve.log")
+
+	stdin := strings.NewReader(filepath.Join(results, "icons", "red") + "\n")
+	if err := run([]string{"-A", goldens, "-l", "-", "-log", logPath}, stdin, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if readFile(t, golden) != readFile(t, "../../testAssets/red.png") {
+		t.Errorf("Approve list test failed, golden image was not replaced")
+	}
+}
+
+func TestApproveChecks(t *testing.T) {
+	goldens, results, golden := setup(t)
+	outside := filepath.Join(t.TempDir(), "red.png")
+	copyAsset(t, "white.png", outside)
+
+	writeMeta(t, filepath.Join(results, "icons", "red"), shared.Comparison{SourceAPath: outside, SourceBPath: filepath.Join(goldens, "..", "B", "icons", "red.png")})
+	if err := run([]string{"-A", goldens, "-d", results, "-log", filepath.Join(t.TempDir(), "approve.log")}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("Approve checks test failed, no error for a target outside A")
+	}
+	if readFile(t, outside) != readFile(t, "../../testAssets/white.png") {
+		t.Error("Approve checks test failed, file outside A was replaced")
+	}
+
+	bmp := filepath.Join(goldens, "..", "B", "icons", "red.bmp")
+	copyAsset(t, "white.bmp", bmp)
+	writeMeta(t, filepath.Join(results, "icons", "red"), shared.Comparison{SourceAPath: golden, SourceBPath: bmp})
+	if err := run([]string{"-A", goldens, "-d", results, "-log", filepath.Join(t.TempDir(), "approve.log")}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("Approve checks test failed, no error for a BMP replacing a PNG")
+	}
+	if readFile(t, golden) != readFile(t, "../../testAssets/white.png") {
+		t.Error("Approve checks test failed, PNG golden was replaced by a BMP")
+	}
+
+	if _, err := validateArgs([]string{"-A", goldens, "-l", "-"}); err == nil {
+		t.Error("Approve checks test failed, a location list without -log was accepted")
+	}
+
+	link := filepath.Join(goldens, "link")
+	if err := os.Symlink(filepath.Dir(outside), link); err != nil {
+		t.Skip(err)
+	}
+	writeMeta(t, filepath.Join(results, "icons", "red"), shared.Comparison{SourceAPath: filepath.Join(link, "red.png"), SourceBPath: filepath.Join(goldens, "..", "B", "icons", "red.png")})
+	if err := run([]string{"-A", goldens, "-d", results, "-log", filepath.Join(t.TempDir(), "approve.log")}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("Approve checks test failed, no error for a target behind a symlink out of A")
+	}
+}
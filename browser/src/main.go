@@ -56,6 +56,7 @@ var imageSettingsList widget.List
 var comparisonList widget.List
 var comparisons []shared.Comparison
 var comparisonButtons []widget.Clickable
+var currentComparison int
 
 var imageMutex = sync.Mutex{}
 
@@ -64,6 +65,7 @@ var subProcessingImages [10]image.Image
 var (
 	directory = flag.String("d", "", "Path to directory to load")
 	scale     = flag.String("s", "1.0", "Scale, helps with performance")
+	watchMeta = flag.Bool("watch", false, "Reload comparisons when their meta.json changes")
 )
 
 func setupDefaults() {
@@ -106,6 +108,14 @@ func main() {
 		w.Option(app.Title("Image-compare browser"))
 		w.Option(app.Size(unit.Dp(1280), unit.Dp(720)))
 
+		if *watchMeta {
+			dirs := []string{}
+			for _, c := range comparisons {
+				dirs = append(dirs, c.Dir)
+			}
+			go watchMetaFiles(w, dirs)
+		}
+
 		if err := drawApp(w); err != nil {
 			log.Fatal(err)
 		}
@@ -153,6 +163,8 @@ func drawApp(w *app.Window) error {
 		case app.FrameEvent:
 			gtx := app.NewContext(&ops, e)
 
+			applyReloads()
+
 			for _, ia := range imagesActive {
 				_, hovered := ia.BlendMode.Hovered()
 				if ia.Alpha.Dragging() || ia.R.Dragging() || ia.G.Dragging() || ia.B.Dragging() || hovered {
@@ -190,9 +202,14 @@ func tabs(gtx C, th *material.Theme) D {
 			return ls.Layout(gtx, len(comparisons), func(gtx C, index int) D {
 				return layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx C) D {
 					if comparisonButtons[index].Pressed() {
+						currentComparison = index
 						setComparison(comparisons[index])
 					}
-					lbl := material.Button(th, &comparisonButtons[index], comparisons[index].SourceA)
+					label := comparisons[index].SourceA
+					if c := comparisons[index]; len(c.OnlyIn) > 0 {
+						label = "only in " + c.OnlyIn + ": " + c.SourceA + c.SourceB
+					}
+					lbl := material.Button(th, &comparisonButtons[index], label)
 					return lbl.Layout(gtx)
 				})
 			})
@@ -330,12 +347,17 @@ func setComparison(comparison shared.Comparison) {
 	imagesActive = []ImageSettings{}
 	imageBrowser = []ClickableImage{}
 
-	filepaths := []string{
-		comparison.Location + "/" + comparison.SourceA,
-		comparison.Location + "/" + comparison.SourceB,
+	filepaths := []string{}
+	for _, s := range []string{comparison.SourceA, comparison.SourceB} {
+		if len(s) > 0 {
+			filepaths = append(filepaths, comparison.Location+"/"+s)
+		}
 	}
 	for _, r := range comparison.Results {
-		filepaths = append(filepaths, comparison.Location+"/"+r.Comparison+".png")
+		filepaths = append(filepaths, comparison.Location+"/"+r.ImageName())
+	}
+	for _, v := range comparison.Visualizations {
+		filepaths = append(filepaths, comparison.Location+"/"+v)
 	}
 
 	for _, p := range filepaths {
@@ -394,7 +416,7 @@ func updateViewImage() {
 		imageMutex.Unlock()
 
 		bounds := imgCopy[0].Image.Bounds()
-		iv := image.NewRGBA(bounds)
+		iv := image.NewRGBA64(bounds)
 
 		numSections := len(subProcessingImages)
 
@@ -420,6 +442,8 @@ func updateViewImage() {
 						subProcessingImages[j] = img.Image.(*image.NRGBA).SubImage(image.Rect(0, start, bounds.Max.X, end))
 					case *image.RGBA:
 						subProcessingImages[j] = img.Image.(*image.RGBA).SubImage(image.Rect(0, start, bounds.Max.X, end))
+					default:
+						subProcessingImages[j] = img.Image
 					}
 
 					var overlayColor color.Color
@@ -431,18 +455,19 @@ func updateViewImage() {
 							baseColor = iv.At(x, y)
 
 							fr, fg, fb, _ := overlayColor.RGBA()
-							r := uint8(math.Round(float64(fr) / 65535.0 * float64(img.R.Value) * 255))
-							g := uint8(math.Round(float64(fg) / 65535.0 * float64(img.G.Value) * 255))
-							b := uint8(math.Round(float64(fb) / 65535.0 * float64(img.B.Value) * 255))
+							r := uint16(math.Round(float64(fr) * float64(img.R.Value)))
+							g := uint16(math.Round(float64(fg) * float64(img.G.Value)))
+							b := uint16(math.Round(float64(fb) * float64(img.B.Value)))
+							overlay := color.RGBA64{r, g, b, 0xffff}
 
 							if img.BlendMode.Value == utils.Blend_Alpha {
-								blendedColor = utils.BlendAlpha(&baseColor, color.RGBA{r, g, b, 255}, float64(img.Alpha.Value))
+								blendedColor = utils.BlendAlpha(&baseColor, overlay, float64(img.Alpha.Value))
 							} else if img.BlendMode.Value == utils.Blend_Lighten {
-								blendedColor = utils.BlendLighten(&baseColor, color.RGBA{r, g, b, 255})
+								blendedColor = utils.BlendLighten(&baseColor, overlay)
 							} else if img.BlendMode.Value == utils.Blend_Darken {
-								blendedColor = utils.BlendDarken(&baseColor, color.RGBA{r, g, b, 255})
+								blendedColor = utils.BlendDarken(&baseColor, overlay)
 							} else {
-								blendedColor = utils.BlendDifference(&baseColor, color.RGBA{r, g, b, 255})
+								blendedColor = utils.BlendDifference(&baseColor, overlay)
 							}
 
 							iv.Set(x, y, blendedColor)
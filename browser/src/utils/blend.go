@@ -18,46 +18,42 @@ func BlendAlpha(base *color.Color, overlay color.Color, alpha float64) color.Col
 
 	overlayAlpha := float64(overlayA) / 65535.0 * alpha
 
-	const map8bit = 1.0 / 65535.0 * 255
-	r := uint8((float64(baseR)*(1-overlayAlpha) + float64(overlayR)*overlayAlpha) * map8bit)
-	g := uint8((float64(baseG)*(1-overlayAlpha) + float64(overlayG)*overlayAlpha) * map8bit)
-	b := uint8((float64(baseB)*(1-overlayAlpha) + float64(overlayB)*overlayAlpha) * map8bit)
+	r := uint16(float64(baseR)*(1-overlayAlpha) + float64(overlayR)*overlayAlpha)
+	g := uint16(float64(baseG)*(1-overlayAlpha) + float64(overlayG)*overlayAlpha)
+	b := uint16(float64(baseB)*(1-overlayAlpha) + float64(overlayB)*overlayAlpha)
 
-	return color.RGBA{r, g, b, 255}
+	return color.RGBA64{r, g, b, 0xffff}
 }
 
 func BlendLighten(base *color.Color, overlay color.Color) color.Color {
 	baseR, baseG, baseB, _ := (*base).RGBA()
 	overlayR, overlayG, overlayB, _ := overlay.RGBA()
 
-	const map8bit = 1.0 / 65535.0 * 255
-	r := uint8(float64(max(baseR, overlayR)) * map8bit)
-	g := uint8(float64(max(baseG, overlayG)) * map8bit)
-	b := uint8(float64(max(baseB, overlayB)) * map8bit)
+	r := uint16(max(baseR, overlayR))
+	g := uint16(max(baseG, overlayG))
+	b := uint16(max(baseB, overlayB))
 
-	return color.RGBA{r, g, b, 255}
+	return color.RGBA64{r, g, b, 0xffff}
 }
 
 func BlendDarken(base *color.Color, overlay color.Color) color.Color {
 	baseR, baseG, baseB, _ := (*base).RGBA()
 	overlayR, overlayG, overlayB, _ := overlay.RGBA()
 
-	const map8bit = 1.0 / 65535.0 * 255
-	r := uint8(float64(min(baseR, overlayR)) * map8bit)
-	g := uint8(float64(min(baseG, overlayG)) * map8bit)
-	b := uint8(float64(min(baseB, overlayB)) * map8bit)
+	r := uint16(min(baseR, overlayR))
+	g := uint16(min(baseG, overlayG))
+	b := uint16(min(baseB, overlayB))
 
-	return color.RGBA{r, g, b, 255}
+	return color.RGBA64{r, g, b, 0xffff}
 }
 
 func BlendDifference(base *color.Color, overlay color.Color) color.Color {
 	baseR, baseG, baseB, _ := (*base).RGBA()
 	overlayR, overlayG, overlayB, _ := overlay.RGBA()
 
-	const map8bit = 1.0 / 65535.0 * 255
-	r := uint8(math.Abs(float64(baseR)-float64(overlayR)) * map8bit)
-	g := uint8(math.Abs(float64(baseG)-float64(overlayG)) * map8bit)
-	b := uint8(math.Abs(float64(baseB)-float64(overlayB)) * map8bit)
+	r := uint16(math.Abs(float64(baseR) - float64(overlayR)))
+	g := uint16(math.Abs(float64(baseG) - float64(overlayG)))
+	b := uint16(math.Abs(float64(baseB) - float64(overlayB)))
 
-	return color.RGBA{r, g, b, 255}
+	return color.RGBA64{r, g, b, 0xffff}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gioui.org/app"
+
+	"ic/shared"
+)
+
+const metaPollInterval = time.Second
+
+var reloadMutex = sync.Mutex{}
+var reloads = map[int]shared.Comparison{}
+
+func metaModTime(dir string) time.Time {
+	info, err := os.Stat(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// watchMetaFiles polls the meta.json in each of dirs and queues the
+// comparisons that changed to be reloaded on the next frame.
+func watchMetaFiles(w *app.Window, dirs []string) {
+	stamps := make([]time.Time, len(dirs))
+	for i, dir := range dirs {
+		stamps[i] = metaModTime(dir)
+	}
+
+	for range time.Tick(metaPollInterval) {
+		for i, dir := range dirs {
+			mod := metaModTime(dir)
+			if mod.IsZero() || mod.Equal(stamps[i]) {
+				continue
+			}
+
+			c, err := shared.ReadMetaFile(filepath.Join(dir, "meta.json"))
+			if err != nil {
+				continue
+			}
+			stamps[i] = mod
+
+			reloadMutex.Lock()
+			reloads[i] = c
+			reloadMutex.Unlock()
+
+			w.Invalidate()
+		}
+	}
+}
+
+// applyReloads replaces the queued comparisons and drops their cached
+// images, the shown comparison is loaded again.
+func applyReloads() {
+	reloadMutex.Lock()
+	pending := reloads
+	reloads = map[int]shared.Comparison{}
+	reloadMutex.Unlock()
+
+	for i, c := range pending {
+		for p := range imageMap {
+			if strings.HasPrefix(p, c.Location+"/") {
+				delete(imageMap, p)
+			}
+		}
+
+		comparisons[i] = c
+		if i == currentComparison {
+			setComparison(c)
+		}
+	}
+}
@@ -6,4 +6,4 @@ replace ic/shared => ../shared
 
 require ic/shared v0.0.0-00010101000000-000000000000
 
-require golang.org/x/image v0.23.0 // indirect
+require golang.org/x/image v0.23.0
@@ -0,0 +1,41 @@
+package algos
+
+import (
+	"context"
+	"ic/compare/imagecompare/utils"
+	"image"
+	"math"
+)
+
+const contrastThreshold = 0.25
+
+func ConstrastCompare(ctx context.Context, set utils.CompareSet) (float64, int, image.Image, error) {
+	bounds := set.ImageA.Bounds()
+	w, h := bounds.Max.X, bounds.Max.Y
+
+	numMatches := 0
+	numFailed := 0
+	result := utils.NewDiffImage(set)
+
+	for x := 0; x < w; x++ {
+		if err := ctx.Err(); err != nil {
+			return 0.0, 0, nil, err
+		}
+		for y := 0; y < h; y++ {
+			grayA := utils.GrayAt(set.ImageA, x, y)
+			grayB := utils.GrayAt(set.ImageB, x, y)
+
+			if math.Abs(grayA-grayB) > contrastThreshold {
+				numFailed++
+				utils.SetDiff(result, x, y, math.Abs(grayA-grayB))
+			} else {
+				numMatches++
+				utils.SetDiff(result, x, y, 0.0)
+			}
+
+		}
+	}
+
+	fraction := float64(numMatches) / float64(w*h)
+	return fraction, numFailed, result, nil
+}
@@ -0,0 +1,39 @@
+package algos
+
+import (
+	"context"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"image"
+)
+
+func MSE(ctx context.Context, set utils.CompareSet) (float64, int, image.Image, error) {
+	bounds := set.ImageA.Bounds()
+	w, h := bounds.Max.X, bounds.Max.Y
+
+	var sumSquaredError float64
+	result := utils.NewDiffImage(set)
+
+	for y := 0; y < h; y++ {
+		if err := ctx.Err(); err != nil {
+			return 0.0, 0, nil, err
+		}
+		for x := 0; x < w; x++ {
+			rf1, gf1, bf1, _ := shared.FloatRGBA(set.ImageA.At(x, y))
+			rf2, gf2, bf2, _ := shared.FloatRGBA(set.ImageB.At(x, y))
+
+			errR := rf1 - rf2
+			errG := gf1 - gf2
+			errB := bf1 - bf2
+			sqe := (errR*errR + errG*errG + errB*errB) / 3
+
+			utils.SetDiff(result, x, y, sqe)
+
+			if sqe != 0.0 {
+				sumSquaredError += sqe
+			}
+		}
+	}
+
+	return 1.0 - (sumSquaredError / float64(w*h)), -1, result, nil
+}
@@ -0,0 +1,20 @@
+package algos
+
+import "ic/shared"
+
+// Params returns the fixed parameters of a comparison, stored with its
+// results so they are self-describing.
+func Params(c shared.ComparisonType) map[string]float64 {
+	switch c {
+	case shared.Contrast:
+		return map[string]float64{"threshold": contrastThreshold}
+	case shared.Quad:
+		return map[string]float64{"threshold": quadThreshold}
+	case shared.SSIM:
+		return map[string]float64{"k1": ssimK1, "k2": ssimK2}
+	case shared.Relative:
+		return map[string]float64{"threshold": RelativeThreshold, "epsilon": relativeEpsilon}
+	default:
+		return nil
+	}
+}
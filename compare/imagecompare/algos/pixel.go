@@ -0,0 +1,39 @@
+package algos
+
+import (
+	"context"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"image"
+	"image/color"
+)
+
+func PixelCompare(ctx context.Context, set utils.CompareSet) (float64, int, image.Image, error) {
+	bounds := set.ImageA.Bounds()
+	w, h := bounds.Max.X, bounds.Max.Y
+
+	numMatches := 0
+	numFailed := 0
+	result := image.NewGray16(bounds)
+
+	for x := 0; x < w; x++ {
+		if err := ctx.Err(); err != nil {
+			return 0.0, 0, nil, err
+		}
+		for y := 0; y < h; y++ {
+			rA, gA, bA, aA := shared.FloatRGBA(set.ImageA.At(x, y))
+			rB, gB, bB, aB := shared.FloatRGBA(set.ImageB.At(x, y))
+			if rA != rB || gA != gB || bA != bB || aA != aB {
+				numFailed++
+				result.Set(x, y, color.White)
+			} else {
+				numMatches++
+				result.Set(x, y, color.Black)
+			}
+
+		}
+	}
+
+	fraction := float64(numMatches) / float64(w*h)
+	return fraction, numFailed, result, nil
+}
@@ -0,0 +1,68 @@
+package algos
+
+import (
+	"context"
+	"fmt"
+	"ic/compare/imagecompare/utils"
+	"image"
+	"math"
+)
+
+const quadThreshold = 0.5
+
+func QuadCompare(ctx context.Context, set utils.CompareSet) (float64, int, image.Image, error) {
+	bounds := set.ImageA.Bounds()
+	w, h := bounds.Max.X, bounds.Max.Y
+
+	if w%2 != 0 || h%2 != 0 {
+		err := fmt.Errorf("quad comparison requires power of two resolution. resolution: %d x %d", w, h)
+		return 0.0, 0, nil, err
+	}
+
+	numMatches := 0
+	numFailed := 0
+	result := utils.NewDiffImage(set)
+
+	for x := 0; x < w; x += 2 {
+		if err := ctx.Err(); err != nil {
+			return 0.0, 0, nil, err
+		}
+		for y := 0; y < h; y += 2 {
+
+			avgGrayA := 0.0
+			avgGrayB := 0.0
+
+			avgGrayA += utils.GrayAt(set.ImageA, x, y)
+			avgGrayA += utils.GrayAt(set.ImageA, x+1, y)
+			avgGrayA += utils.GrayAt(set.ImageA, x, y+1)
+			avgGrayA += utils.GrayAt(set.ImageA, x+1, y+1)
+
+			avgGrayB += utils.GrayAt(set.ImageB, x, y)
+			avgGrayB += utils.GrayAt(set.ImageB, x+1, y)
+			avgGrayB += utils.GrayAt(set.ImageB, x, y+1)
+			avgGrayB += utils.GrayAt(set.ImageB, x+1, y+1)
+
+			avgGrayA /= 4.0
+			avgGrayB /= 4.0
+
+			if math.Abs(avgGrayA-avgGrayB) > quadThreshold {
+				numFailed += 4
+				d := math.Abs(avgGrayA - avgGrayB)
+				utils.SetDiff(result, x, y, d)
+				utils.SetDiff(result, x+1, y, d)
+				utils.SetDiff(result, x, y+1, d)
+				utils.SetDiff(result, x+1, y+1, d)
+			} else {
+				numMatches += 4
+				utils.SetDiff(result, x, y, 0.0)
+				utils.SetDiff(result, x+1, y, 0.0)
+				utils.SetDiff(result, x, y+1, 0.0)
+				utils.SetDiff(result, x+1, y+1, 0.0)
+			}
+
+		}
+	}
+
+	fraction := float64(numMatches) / float64(w*h)
+	return fraction, numFailed, result, nil
+}
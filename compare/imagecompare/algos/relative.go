@@ -0,0 +1,47 @@
+package algos
+
+import (
+	"context"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"image"
+	"math"
+)
+
+const RelativeThreshold = 0.01
+
+// Radiance below this is treated as black so dark pixels don't dominate.
+const relativeEpsilon = 1e-4
+
+func RelativeCompare(ctx context.Context, set utils.CompareSet) (float64, int, image.Image, error) {
+	bounds := set.ImageA.Bounds()
+	w, h := bounds.Max.X, bounds.Max.Y
+
+	var sumError float64
+	numFailed := 0
+	result := utils.NewDiffImage(set)
+
+	for y := 0; y < h; y++ {
+		if err := ctx.Err(); err != nil {
+			return 0.0, 0, nil, err
+		}
+		for x := 0; x < w; x++ {
+			rA, gA, bA, _ := shared.FloatRGBA(set.ImageA.At(x, y))
+			rB, gB, bB, _ := shared.FloatRGBA(set.ImageB.At(x, y))
+
+			e := math.Max(relativeError(rA, rB), math.Max(relativeError(gA, gB), relativeError(bA, bB)))
+			if e > RelativeThreshold {
+				numFailed++
+			}
+
+			sumError += e
+			utils.SetDiff(result, x, y, e)
+		}
+	}
+
+	return 1.0 - (sumError / float64(w*h)), numFailed, result, nil
+}
+
+func relativeError(a, b float64) float64 {
+	return math.Abs(a-b) / math.Max(math.Max(math.Abs(a), math.Abs(b)), relativeEpsilon)
+}
@@ -0,0 +1,56 @@
+package algos
+
+import (
+	"context"
+	"ic/compare/imagecompare/utils"
+	"image"
+	"math"
+)
+
+// Stabilizing constants of the SSIM formula.
+const ssimK1 = 0.01
+const ssimK2 = 0.03
+
+func SSIM(ctx context.Context, set utils.CompareSet) (float64, int, image.Image, error) {
+
+	gray1 := utils.ConvertToGray(set.ImageA)
+	gray2 := utils.ConvertToGray(set.ImageB)
+
+	// The statistics are computed over the whole image, so cancellation is
+	// only checked between the passes.
+	if err := ctx.Err(); err != nil {
+		return 0.0, 0, nil, err
+	}
+
+	mean1 := utils.Mean(gray1)
+	mean2 := utils.Mean(gray2)
+
+	variance1 := utils.Variance(gray1, mean1)
+	variance2 := utils.Variance(gray2, mean2)
+
+	cov, pixels := utils.Covariance(gray1, gray2, mean1, mean2)
+
+	if err := ctx.Err(); err != nil {
+		return 0.0, 0, nil, err
+	}
+
+	c1 := ssimK1 * ssimK1
+	c2 := ssimK2 * ssimK2
+
+	ssim := ((2*mean1*mean2 + c1) * (2*cov + c2)) / ((mean1*mean1 + mean2*mean2 + c1) * (variance1 + variance2 + c2))
+
+	bounds := set.ImageA.Bounds()
+	w, h := bounds.Max.X, bounds.Max.Y
+
+	result := utils.NewDiffImage(set)
+
+	i := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			utils.SetDiff(result, x, y, pixels[i])
+			i++
+		}
+	}
+
+	return math.Abs(ssim), -1, result, nil
+}
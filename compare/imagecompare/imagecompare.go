@@ -0,0 +1,325 @@
+// Package imagecompare compares in-memory images with the comparators of the
+// compare command, without reading or writing any files.
+package imagecompare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ic/compare/imagecompare/algos"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"image"
+	"image/draw"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSizeMismatch is returned by Compare for images of different sizes.
+var ErrSizeMismatch = errors.New("image sizes differ")
+
+type Options struct {
+	// Comparisons to run, all except relative when empty.
+	Comparisons []shared.ComparisonType
+
+	// MinIndex is the minimum index of every comparison for a pass, 0
+	// disables the check. MinIndexes overrides it per comparison type.
+	MinIndex   float64
+	MinIndexes map[string]float64
+
+	// MaxFailed and MaxRegion limit the failed points and the largest
+	// connected failed region, nil disables the check. Use Limit(0) to allow
+	// no failed points at all.
+	MaxFailed *int
+	MaxRegion *int
+
+	// Threads is the number of pairs CompareDirs compares at once.
+	Threads int
+}
+
+// DefaultOptions runs all comparisons without thresholds, so every pair
+// passes. The zero value of Options does the same.
+func DefaultOptions() Options {
+	return Options{
+		Comparisons: shared.GetComparisons("all"),
+		Threads:     1,
+	}
+}
+
+// Limit returns a pointer to n for MaxFailed and MaxRegion.
+func Limit(n int) *int {
+	return &n
+}
+
+type Result struct {
+	Results []shared.ResultData
+	// Diffs holds the diff image of each result.
+	Diffs   []image.Image
+	Passed  bool
+	Reasons []string
+	// Errors of comparators that could not run, the other results are
+	// still valid.
+	Errors []string
+}
+
+// toOrigin returns img with its bounds moved to start at (0, 0), the
+// comparators index pixels from there. Sub-images are copied.
+func toOrigin(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if bounds.Min == (image.Point{}) {
+		return img
+	}
+
+	var dst draw.Image = image.NewRGBA64(bounds.Sub(bounds.Min))
+	if shared.BitDepth(img) == 32 {
+		dst = shared.NewImageF32(bounds.Sub(bounds.Min))
+	}
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// Compare runs every comparison of opts on a and b, which must have the same
+// size. Bounds that don't start at (0, 0) are compared from their origin and
+// the diffs start at (0, 0). The returned error is only set when the sizes
+// differ (ErrSizeMismatch), ctx is done or a comparison type is unknown.
+func Compare(ctx context.Context, a, b image.Image, opts Options) (Result, error) {
+	comparisons := opts.Comparisons
+	if len(comparisons) == 0 {
+		comparisons = shared.GetComparisons("all")
+	}
+
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return Result{}, fmt.Errorf("%w, %v and %v", ErrSizeMismatch, a.Bounds().Size(), b.Bounds().Size())
+	}
+
+	set := utils.CompareSet{ImageA: toOrigin(a), ImageB: toOrigin(b)}
+
+	r := Result{Results: []shared.ResultData{}, Diffs: []image.Image{}}
+	for _, c := range comparisons {
+		var index float64
+		var numFailed int
+		var img image.Image
+		var err error
+
+		start := time.Now()
+		switch c {
+		case shared.Pixel:
+			index, numFailed, img, err = algos.PixelCompare(ctx, set)
+		case shared.Contrast:
+			index, numFailed, img, err = algos.ConstrastCompare(ctx, set)
+		case shared.Quad:
+			index, numFailed, img, err = algos.QuadCompare(ctx, set)
+		case shared.SSIM:
+			index, numFailed, img, err = algos.SSIM(ctx, set)
+		case shared.MSE:
+			index, numFailed, img, err = algos.MSE(ctx, set)
+		case shared.Relative:
+			index, numFailed, img, err = algos.RelativeCompare(ctx, set)
+		default:
+			return Result{}, fmt.Errorf("comparison type \"%v\" not supported", c)
+		}
+
+		// Cancellation aborts the pair, other errors only skip the comparator.
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		if err != nil {
+			r.Errors = append(r.Errors, err.Error())
+			continue
+		}
+
+		r.Results = append(r.Results, shared.ResultData{
+			Comparison: string(c),
+			Index:      index,
+			NumFailed:  numFailed,
+			Params:     algos.Params(c),
+			Seconds:    time.Since(start).Seconds(),
+		})
+		r.Diffs = append(r.Diffs, img)
+	}
+
+	if opts.MaxRegion != nil {
+		for i, res := range r.Results {
+			if res.NumFailed >= 0 {
+				r.Results[i].Region = utils.LargestRegion(r.Diffs[i], failThreshold(res.Comparison))
+			}
+		}
+	}
+
+	r.Reasons = Thresholds(r.Results, opts)
+	r.Passed = len(r.Reasons) == 0 && len(r.Errors) == 0
+
+	return r, nil
+}
+
+// Identical scores two images of size bounds that are known to be identical,
+// ex. byte-identical files, as a perfect match without running the
+// comparators. The diffs are blank.
+func Identical(bounds image.Rectangle, opts Options) Result {
+	comparisons := opts.Comparisons
+	if len(comparisons) == 0 {
+		comparisons = shared.GetComparisons("all")
+	}
+
+	r := Result{Results: []shared.ResultData{}, Diffs: []image.Image{}}
+	for _, c := range comparisons {
+		result := shared.ResultData{Comparison: string(c), Index: 1.0, Params: algos.Params(c)}
+
+		switch c {
+		case shared.SSIM, shared.MSE:
+			result.NumFailed = -1
+		case shared.Quad:
+			if bounds.Dx()%2 != 0 || bounds.Dy()%2 != 0 {
+				r.Errors = append(r.Errors, fmt.Sprintf("quad comparison requires power of two resolution. resolution: %d x %d", bounds.Dx(), bounds.Dy()))
+				continue
+			}
+		}
+
+		r.Results = append(r.Results, result)
+		r.Diffs = append(r.Diffs, image.NewGray16(bounds))
+	}
+
+	r.Reasons = Thresholds(r.Results, opts)
+	r.Passed = len(r.Reasons) == 0 && len(r.Errors) == 0
+
+	return r
+}
+
+// ParseMinIndex reads the -min-index syntax of compare, a plain value applies to every
+// comparison type and "type=value" entries override it per type.
+func ParseMinIndex(s string) (float64, map[string]float64, error) {
+	all := 0.0
+	perType := map[string]float64{}
+	if len(s) == 0 {
+		return all, perType, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		name, value, found := strings.Cut(entry, "=")
+		if !found {
+			value = name
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid min index \"%s\"", entry)
+		}
+
+		if !found {
+			all = v
+			continue
+		}
+
+		if len(shared.GetComparisons(name)) != 1 || name == "all" {
+			return 0, nil, fmt.Errorf("comparison type \"%s\" not supported", name)
+		}
+		perType[name] = v
+	}
+
+	return all, perType, nil
+}
+
+// failThreshold is the diff value above which a pixel counts as failed.
+func failThreshold(comparison string) float64 {
+	if comparison == string(shared.Relative) {
+		return algos.RelativeThreshold
+	}
+	return 0.0
+}
+
+func minIndex(opts Options, comparison string) float64 {
+	if v, ok := opts.MinIndexes[comparison]; ok {
+		return v
+	}
+	return opts.MinIndex
+}
+
+// Thresholds lists every result that violates the thresholds of opts.
+// Results without a failed count (-1) only check the index.
+func Thresholds(results []shared.ResultData, opts Options) []string {
+	failures := []string{}
+	for _, r := range results {
+		if min := minIndex(opts, r.Comparison); min > 0 && r.Index < min {
+			failures = append(failures, fmt.Sprintf("%s index %v below %v", r.Comparison, r.Index, min))
+		}
+		if r.NumFailed < 0 {
+			continue
+		}
+		if opts.MaxFailed != nil && r.NumFailed > *opts.MaxFailed {
+			failures = append(failures, fmt.Sprintf("%s failed points %d above %d", r.Comparison, r.NumFailed, *opts.MaxFailed))
+		}
+		if opts.MaxRegion != nil && r.Region > *opts.MaxRegion {
+			failures = append(failures, fmt.Sprintf("%s failed region %d above %d", r.Comparison, r.Region, *opts.MaxRegion))
+		}
+	}
+	return failures
+}
+
+type DirResult struct {
+	// Pairs maps every name present in both sets to its result.
+	Pairs   map[string]Result
+	OnlyInA []string
+	OnlyInB []string
+}
+
+func (d DirResult) Passed() bool {
+	for _, r := range d.Pairs {
+		if !r.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareDirs compares the images of a and b with the same name, names are
+// typically relative paths. Names only in a or b are listed, not compared.
+func CompareDirs(ctx context.Context, a, b map[string]image.Image, opts Options) (DirResult, error) {
+	d := DirResult{Pairs: map[string]Result{}, OnlyInA: []string{}, OnlyInB: []string{}}
+
+	names := []string{}
+	for name := range a {
+		if _, ok := b[name]; ok {
+			names = append(names, name)
+		} else {
+			d.OnlyInA = append(d.OnlyInA, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			d.OnlyInB = append(d.OnlyInB, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(d.OnlyInA)
+	sort.Strings(d.OnlyInB)
+
+	sem := make(chan struct{}, max(1, opts.Threads))
+	results := make([]Result, len(names))
+	errs := make([]error, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i], errs[i] = Compare(ctx, a[name], b[name], opts)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if errs[i] != nil {
+			return DirResult{}, fmt.Errorf("%s: %v", name, errs[i])
+		}
+		d.Pairs[name] = results[i]
+	}
+
+	return d, nil
+}
@@ -0,0 +1,173 @@
+package imagecompare
+
+import (
+	"context"
+	"errors"
+	"ic/shared"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solid(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestCompare(t *testing.T) {
+	a := solid(color.White)
+	b := solid(color.White)
+	b.(*image.RGBA).Set(3, 3, color.Black)
+
+	opts := DefaultOptions()
+	opts.Comparisons = []shared.ComparisonType{shared.Pixel, shared.SSIM}
+
+	r, err := Compare(context.Background(), a, a, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Passed || len(r.Results) != 2 || len(r.Diffs) != 2 {
+		t.Fatalf("identical images: %+v", r)
+	}
+	for _, res := range r.Results {
+		if res.Index != 1 {
+			t.Errorf("%s index %v, expected 1", res.Comparison, res.Index)
+		}
+	}
+
+	r, err = Compare(context.Background(), a, b, Options{Comparisons: opts.Comparisons})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Passed || r.Results[0].Region != 0 {
+		t.Fatalf("expected the zero options to pass without regions: %+v", r)
+	}
+
+	opts.MaxFailed = Limit(0)
+	opts.MaxRegion = Limit(0)
+	r, err = Compare(context.Background(), a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Passed {
+		t.Fatal("expected different images to fail")
+	}
+	if r.Results[0].NumFailed != 1 || r.Results[0].Region != 1 {
+		t.Errorf("pixel result %+v, expected 1 failed point in a region of 1", r.Results[0])
+	}
+	if len(r.Reasons) != 2 {
+		t.Errorf("reasons %v, expected failed points and region", r.Reasons)
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 7, 7))
+
+	opts := DefaultOptions()
+	opts.Comparisons = []shared.ComparisonType{shared.Pixel, shared.Quad}
+
+	r, err := Compare(context.Background(), a, a, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Passed || len(r.Errors) != 1 || len(r.Results) != 1 {
+		t.Fatalf("expected a quad error next to the pixel result: %+v", r)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Compare(ctx, a, a, opts); err == nil {
+		t.Fatal("expected an error for a cancelled context")
+	}
+
+	if _, err := Compare(context.Background(), a, solid(color.White), DefaultOptions()); !errors.Is(err, ErrSizeMismatch) {
+		t.Fatal("expected an error for different sizes")
+	}
+}
+
+func TestCompareSubImage(t *testing.T) {
+	large := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 8; y < 16; y++ {
+		for x := 8; x < 16; x++ {
+			large.Set(x, y, color.White)
+		}
+	}
+	large.Set(11, 11, color.Black)
+	sub := large.SubImage(image.Rect(8, 8, 16, 16))
+
+	opts := DefaultOptions()
+	opts.Comparisons = []shared.ComparisonType{shared.Pixel, shared.SSIM}
+
+	r, err := Compare(context.Background(), solid(color.White), sub, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Results) != 2 || r.Results[0].NumFailed != 1 || r.Results[1].Index == 1 {
+		t.Fatalf("expected one differing pixel: %+v", r)
+	}
+	if r.Diffs[0].Bounds() != image.Rect(0, 0, 8, 8) {
+		t.Errorf("diff bounds %v, expected (0,0)-(8,8)", r.Diffs[0].Bounds())
+	}
+
+	r, err = Compare(context.Background(), sub, sub, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Passed || r.Results[0].Index != 1 || r.Results[1].Index != 1 {
+		t.Errorf("expected a sub-image to match itself: %+v", r)
+	}
+}
+
+func TestIdentical(t *testing.T) {
+	opts := Options{Comparisons: []shared.ComparisonType{shared.Pixel, shared.SSIM, shared.Quad}, MaxFailed: Limit(0)}
+
+	r := Identical(image.Rect(0, 0, 8, 8), opts)
+	if !r.Passed || len(r.Results) != 3 || len(r.Diffs) != 3 {
+		t.Fatalf("identical images: %+v", r)
+	}
+	if r.Results[0].Index != 1 || r.Results[0].NumFailed != 0 || r.Results[1].NumFailed != -1 {
+		t.Errorf("unexpected results %+v", r.Results)
+	}
+
+	r = Identical(image.Rect(0, 0, 7, 7), opts)
+	if r.Passed || len(r.Errors) != 1 || len(r.Results) != 2 {
+		t.Errorf("expected a quad error for odd sizes: %+v", r)
+	}
+}
+
+func TestCompareDirs(t *testing.T) {
+	a := map[string]image.Image{
+		"same.png":     solid(color.White),
+		"diff.png":     solid(color.White),
+		"only_a/x.png": solid(color.White),
+	}
+	b := map[string]image.Image{
+		"same.png":     solid(color.White),
+		"diff.png":     solid(color.Black),
+		"only_b/y.png": solid(color.White),
+	}
+
+	opts := DefaultOptions()
+	opts.Comparisons = []shared.ComparisonType{shared.Pixel}
+	opts.MaxFailed = Limit(0)
+	opts.Threads = 2
+
+	d, err := CompareDirs(context.Background(), a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Pairs) != 2 || !d.Pairs["same.png"].Passed || d.Pairs["diff.png"].Passed {
+		t.Fatalf("unexpected pairs: %+v", d.Pairs)
+	}
+	if d.Passed() {
+		t.Error("expected the set to fail")
+	}
+	if len(d.OnlyInA) != 1 || d.OnlyInA[0] != "only_a/x.png" || len(d.OnlyInB) != 1 || d.OnlyInB[0] != "only_b/y.png" {
+		t.Errorf("only in A %v, only in B %v", d.OnlyInA, d.OnlyInB)
+	}
+}
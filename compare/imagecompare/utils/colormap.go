@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Ten evenly spaced samples of the matplotlib colormaps, interpolated
+// linearly in between.
+var colormaps = map[string][]color.NRGBA{
+	"viridis": {
+		{0x44, 0x01, 0x54, 0xff}, {0x48, 0x28, 0x78, 0xff}, {0x3e, 0x4a, 0x89, 0xff}, {0x31, 0x68, 0x8e, 0xff}, {0x26, 0x82, 0x8e, 0xff},
+		{0x1f, 0x9e, 0x89, 0xff}, {0x35, 0xb7, 0x79, 0xff}, {0x6d, 0xcd, 0x59, 0xff}, {0xb4, 0xde, 0x2c, 0xff}, {0xfd, 0xe7, 0x25, 0xff},
+	},
+	"inferno": {
+		{0x00, 0x00, 0x04, 0xff}, {0x1b, 0x0c, 0x42, 0xff}, {0x4b, 0x0c, 0x6b, 0xff}, {0x78, 0x1c, 0x6d, 0xff}, {0xa5, 0x2c, 0x60, 0xff},
+		{0xcf, 0x44, 0x46, 0xff}, {0xed, 0x69, 0x25, 0xff}, {0xfb, 0x9a, 0x06, 0xff}, {0xf7, 0xd0, 0x3c, 0xff}, {0xfc, 0xff, 0xa4, 0xff},
+	},
+}
+
+func ValidateColormap(name string) error {
+	if _, ok := colormaps[name]; !ok {
+		return fmt.Errorf("colormap \"%s\" not supported", name)
+	}
+	return nil
+}
+
+// MapColor returns the color of v in [0, 1] in the named colormap.
+func MapColor(name string, v float64) color.NRGBA {
+	stops := colormaps[name]
+
+	pos := math.Max(0.0, math.Min(v, 1.0)) * float64(len(stops)-1)
+	i := int(pos)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+
+	t := pos - float64(i)
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-t) + float64(b)*t))
+	}
+
+	a, b := stops[i], stops[i+1]
+	return color.NRGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 0xff}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"ic/shared"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+func GetGrayValue(r uint32, g uint32, b uint32) float64 {
+	gray := 0.2125*float64(r) + 0.7154*float64(g) + 0.0721*float64(b)
+	return gray / float64(0xffff)
+}
+
+// GrayAt keeps float sources at full precision, other sources go through
+// the 16-bit RGBA values.
+func GrayAt(img image.Image, x, y int) float64 {
+	c := img.At(x, y)
+	if _, ok := c.(shared.ColorF32); ok {
+		r, g, b, _ := shared.FloatRGBA(c)
+		return 0.2125*r + 0.7154*g + 0.0721*b
+	}
+
+	r, g, b, _ := c.RGBA()
+	return GetGrayValue(r, g, b)
+}
+
+func ConvertToGray(img image.Image) []float64 {
+	bounds := img.Bounds()
+	graySlice := []float64{}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			graySlice = append(graySlice, GrayAt(img, x, y))
+		}
+	}
+	return graySlice
+}
+
+func Mean(graySlice []float64) float64 {
+	var sum float64
+	for _, g := range graySlice {
+		sum += g
+	}
+
+	return sum / float64(len(graySlice))
+}
+
+func Variance(graySlice []float64, mean float64) float64 {
+	var sum float64
+	for _, g := range graySlice {
+		diff := g - mean
+		sum += diff * diff
+	}
+
+	return sum / float64(len(graySlice))
+}
+
+func Covariance(graySlice1, graySlice2 []float64, mean1, mean2 float64) (float64, []float64) {
+	var sum float64
+	pixelSum := []float64{}
+	for i, _ := range graySlice1 {
+		diff1 := graySlice1[i] - mean1
+		diff2 := graySlice2[i] - mean2
+
+		d := diff1 * diff2
+		pixelSum = append(pixelSum, d)
+		sum += d
+	}
+
+	return sum / float64(len(graySlice1)), pixelSum
+}
+
+// NewDiffImage keeps diff values above 1.0 when either source is a float
+// image, other sources get a 16-bit gray diff.
+func NewDiffImage(set CompareSet) draw.Image {
+	bounds := set.ImageA.Bounds()
+	if shared.BitDepth(set.ImageA) == 32 || shared.BitDepth(set.ImageB) == 32 {
+		return shared.NewImageF32(bounds)
+	}
+	return image.NewGray16(bounds)
+}
+
+func SetDiff(img draw.Image, x, y int, v float64) {
+	v = math.Max(v, 0.0)
+	if f, ok := img.(*shared.ImageF32); ok {
+		f.SetF32(x, y, shared.ColorF32{R: float32(v), G: float32(v), B: float32(v), A: 1})
+		return
+	}
+	img.Set(x, y, color.Gray16{uint16(0xffff * math.Min(v, 1.0))})
+}
+
+// ToGray converts a diff image to 8 or 16 bits per pixel.
+func ToGray(img image.Image, depth int) image.Image {
+	var gray draw.Image
+	if depth == 16 {
+		gray = image.NewGray16(img.Bounds())
+	} else {
+		gray = image.NewGray(img.Bounds())
+	}
+	draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+	return gray
+}
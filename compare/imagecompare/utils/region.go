@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"ic/shared"
+	"image"
+)
+
+// LargestRegion returns the size in pixels of the largest 8-connected region
+// of diff values above threshold.
+func LargestRegion(diff image.Image, threshold float64) int {
+	bounds := diff.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	failed := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v, _, _, _ := shared.FloatRGBA(diff.At(bounds.Min.X+x, bounds.Min.Y+y))
+			failed[y*w+x] = v > threshold
+		}
+	}
+
+	largest := 0
+	stack := []int{}
+	for i := range failed {
+		if !failed[i] {
+			continue
+		}
+
+		size := 0
+		failed[i] = false
+		stack = append(stack[:0], i)
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			size++
+
+			px, py := p%w, p/w
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := px+dx, py+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h || !failed[ny*w+nx] {
+						continue
+					}
+					failed[ny*w+nx] = false
+					stack = append(stack, ny*w+nx)
+				}
+			}
+		}
+
+		largest = max(largest, size)
+	}
+
+	return largest
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"ic/shared"
+	"image"
+	"regexp"
+	"time"
+)
+
+type CompareData struct {
+	SourceA     string
+	SourceB     string
+	IsDir       bool
+	Comparisons []shared.ComparisonType
+	ExportDest  string
+	Threads int
+	IgnoreOrientation bool
+	DiffFormat string
+	DiffDepth int
+	Exposure float64
+	Visualizations []string
+	Colormap string
+	MinIndex float64
+	MinIndexes map[string]float64
+	MaxFailed int
+	MaxRegion int
+	JUnit string
+	Format string
+	MissingFails bool
+	Pairing string
+	PairRegexA *regexp.Regexp
+	PairRegexB *regexp.Regexp
+	Manifest string
+	Include []string
+	Exclude []string
+	Incremental bool
+	Resume bool
+	FailFast bool
+	Timeout time.Duration
+	Progress string
+	Watch bool
+	WatchInterval time.Duration
+	Overrides []Override
+	ConfigDump []byte
+}
+
+// Override replaces settings of the pairs whose path matches the Match glob.
+type Override struct {
+	Match string
+	Settings map[string]string
+}
+
+type CompareSet struct {
+	Data   CompareData
+	ImageA image.Image
+	ImageB image.Image
+	ImageAPath string
+    ImageBPath string
+	InfoA      shared.ImageInfo
+	InfoB      shared.ImageInfo
+	HashA      string
+	HashB      string
+}
@@ -0,0 +1,134 @@
+// Package imagetest asserts that images match golden files in Go tests.
+//
+// Run the tests with -update to write the actual images as the new goldens.
+package imagetest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ic/compare/imagecompare"
+	"ic/shared"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update is namespaced so it doesn't clash with an -update flag of the
+// package under test.
+var update = flag.Bool("imagetest.update", false, "Rewrite golden images with the actual images.")
+
+type config struct {
+	opts      imagecompare.Options
+	outputDir string
+}
+
+type Option func(*config)
+
+// Comparisons replaces the default pixel comparison.
+func Comparisons(comparisons ...shared.ComparisonType) Option {
+	return func(c *config) { c.opts.Comparisons = comparisons }
+}
+
+func MinIndex(min float64) Option {
+	return func(c *config) { c.opts.MinIndex = min }
+}
+
+// MaxFailed allows up to n failed points, the default is 0.
+func MaxFailed(n int) Option {
+	return func(c *config) { c.opts.MaxFailed = imagecompare.Limit(n) }
+}
+
+func MaxRegion(n int) Option {
+	return func(c *config) { c.opts.MaxRegion = imagecompare.Limit(n) }
+}
+
+// Options replaces all comparison settings.
+func Options(opts imagecompare.Options) Option {
+	return func(c *config) { c.opts = opts }
+}
+
+// OutputDir sets where the actual and diff images of failed assertions are
+// written, in a subdirectory per test. Defaults to imagetest in the temp
+// directory.
+func OutputDir(dir string) Option {
+	return func(c *config) { c.outputDir = dir }
+}
+
+// AssertImageMatches compares got against the golden image at goldenPath and
+// fails t when they don't match, by default when any pixel differs.
+func AssertImageMatches(t testing.TB, got image.Image, goldenPath string, opts ...Option) bool {
+	t.Helper()
+
+	c := config{
+		opts:      imagecompare.DefaultOptions(),
+		outputDir: filepath.Join(os.TempDir(), "imagetest"),
+	}
+	c.opts.Comparisons = []shared.ComparisonType{shared.Pixel}
+	c.opts.MaxFailed = imagecompare.Limit(0)
+	for _, o := range opts {
+		o(&c)
+	}
+
+	if *update {
+		if err := writeImage(goldenPath, got); err != nil {
+			t.Fatalf("updating golden %s: %v", goldenPath, err)
+		}
+		return true
+	}
+
+	want, err := shared.LoadImage(goldenPath)
+	if err != nil {
+		t.Errorf("loading golden %s: %v, run with -imagetest.update to create it", goldenPath, err)
+		return false
+	}
+
+	dir := filepath.Join(c.outputDir, filepath.FromSlash(t.Name()))
+
+	if want.Bounds().Size() != got.Bounds().Size() {
+		writeImage(filepath.Join(dir, "actual.png"), got)
+		t.Errorf("image size %v does not match golden %s size %v, actual image in %s", got.Bounds().Size(), goldenPath, want.Bounds().Size(), dir)
+		return false
+	}
+
+	r, err := imagecompare.Compare(context.Background(), want, got, c.opts)
+	if err != nil {
+		t.Errorf("comparing with golden %s: %v", goldenPath, err)
+		return false
+	}
+	if r.Passed {
+		return true
+	}
+
+	if err := writeImage(filepath.Join(dir, "actual.png"), got); err != nil {
+		t.Log(err)
+	}
+	for i, res := range r.Results {
+		if err := writeImage(filepath.Join(dir, res.Comparison+".png"), r.Diffs[i]); err != nil {
+			t.Log(err)
+		}
+	}
+
+	t.Errorf("image does not match golden %s: %s, actual and diff images in %s", goldenPath, strings.Join(append(r.Reasons, r.Errors...), ", "), dir)
+	return false
+}
+
+// writeImage encodes img in the format of the path extension.
+func writeImage(path string, img image.Image) error {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	err := shared.CreateAtomic(path, func(w io.Writer) error {
+		return shared.EncodeImage(w, img, format)
+	})
+	if err != nil {
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	return nil
+}
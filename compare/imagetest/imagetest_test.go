@@ -0,0 +1,97 @@
+package imagetest
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recorder captures failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func gray(v uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func TestAssertImageMatches(t *testing.T) {
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "golden.png")
+	if err := writeImage(golden, gray(255)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !AssertImageMatches(t, gray(255), golden) {
+		t.Fatal("expected identical images to match")
+	}
+
+	got := gray(255)
+	got.SetGray(1, 1, color.Gray{0})
+
+	r := &recorder{TB: t}
+	out := filepath.Join(dir, "out")
+	if AssertImageMatches(r, got, golden, OutputDir(out)) || len(r.failures) != 1 {
+		t.Fatalf("expected one failure, got %v", r.failures)
+	}
+	for _, name := range []string{"actual.png", "pixel.png"} {
+		if _, err := os.Stat(filepath.Join(out, t.Name(), name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	r = &recorder{TB: t}
+	if !AssertImageMatches(r, got, golden, MaxFailed(1)) || len(r.failures) != 0 {
+		t.Errorf("expected a match with 1 failed point allowed, got %v", r.failures)
+	}
+}
+
+func TestAssertImageMatchesMissing(t *testing.T) {
+	r := &recorder{TB: t}
+	if AssertImageMatches(r, gray(0), filepath.Join(t.TempDir(), "missing.png")) || len(r.failures) != 1 {
+		t.Errorf("expected a failure for a missing golden, got %v", r.failures)
+	}
+}
+
+func TestAssertImageMatchesSize(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "golden.png")
+	if err := writeImage(golden, gray(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{TB: t}
+	if AssertImageMatches(r, image.NewGray(image.Rect(0, 0, 2, 2)), golden, OutputDir(t.TempDir())) || len(r.failures) != 1 {
+		t.Errorf("expected a failure for a size mismatch, got %v", r.failures)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	*update = true
+	defer func() { *update = false }()
+
+	golden := filepath.Join(t.TempDir(), "sub", "golden.pgm")
+	if !AssertImageMatches(t, gray(128), golden) {
+		t.Fatal("expected update to pass")
+	}
+
+	*update = false
+	AssertImageMatches(t, gray(128), golden)
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"ic/compare/src/algos"
-	"ic/compare/src/utils"
+	"ic/compare/imagecompare"
+	"ic/compare/imagecompare/utils"
 	"ic/shared"
 	"image"
-	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,15 +21,13 @@ func copy(src string, dst string) error {
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(dst, data, 0644)
-	if err != nil {
-		return err
-	}
 
-	return nil
+	return shared.WriteFileAtomic(dst, data)
 }
 
-func export(data utils.CompareData, images []image.Image, comparison shared.Comparison) error {
+func export(set utils.CompareSet, images []image.Image, comparison shared.Comparison) error {
+	data := set.Data
+
 	_, err := os.Stat(comparison.Location)
 	if err != nil {
 		return err
@@ -40,26 +39,36 @@ func export(data utils.CompareData, images []image.Image, comparison shared.Comp
 	copy(data.SourceB, filepath.Join(comparison.Location, filepath.Base(comparison.SourceB)))
 
 	for i, r := range comparison.Results {
-		filename := r.Comparison + ".png"
+		img := images[i]
+		if data.DiffFormat != "pfm" {
+			img = utils.ToGray(displayable(img, data.Exposure), data.DiffDepth)
+		}
 
-		f, err := os.Create(filepath.Join(comparison.Location, filename))
+		err := shared.CreateAtomic(filepath.Join(comparison.Location, r.ImageName()), func(w io.Writer) error {
+			return shared.EncodeImage(w, img, data.DiffFormat)
+		})
 		if err != nil {
 			return err
 		}
-		defer f.Close()
 
-		if err := png.Encode(f, images[i]); err != nil {
-			return err
-		}
+		images[i] = displayable(images[i], data.Exposure)
 	}
 
+	if err := exportVisualizations(set, images, comparison); err != nil {
+		return err
+	}
+
+	return writeMeta(comparison)
+}
+
+func writeMeta(comparison shared.Comparison) error {
 	jsonData, err := json.MarshalIndent(comparison, "", "  ")
 	if err != nil {
 		err = fmt.Errorf("error marshaling json: %v", err)
 		return err
 	}
 
-	err = os.WriteFile(filepath.Join(comparison.Location, "meta.json"), jsonData, 0644)
+	err = shared.WriteFileAtomic(filepath.Join(comparison.Location, "meta.json"), jsonData)
 	if err != nil {
 		err = fmt.Errorf("error writing to file: %v", err)
 		return err
@@ -68,58 +77,135 @@ func export(data utils.CompareData, images []image.Image, comparison shared.Comp
 	return nil
 }
 
-func Compare(set utils.CompareSet) (shared.Comparison, error) {
+func Compare(ctx context.Context, set utils.CompareSet) (shared.Comparison, error) {
 	if len(set.Data.Comparisons) == 0 {
 		return shared.Comparison{}, fmt.Errorf("no comparison type set")
 	}
 
-	results := []shared.ResultData{}
-	images := []image.Image{}
-	for _, c := range set.Data.Comparisons {
-		var index float64
-		var numFailed int
-		var img image.Image
-		var err error
-		var result shared.ResultData
-
-		switch c {
-		case shared.Pixel:
-			index, numFailed, img = algos.PixelCompare(set)
-			result = shared.ResultData{Comparison: string(shared.Pixel), Index: index, NumFailed: numFailed}
-		case shared.Contrast:
-			index, numFailed, img = algos.ConstrastCompare(set)
-			result = shared.ResultData{Comparison: string(shared.Contrast), Index: index, NumFailed: numFailed}
-		case shared.Quad:
-			index, numFailed, img, err = algos.QuadCompare(set)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			result = shared.ResultData{Comparison: string(shared.Quad), Index: index, NumFailed: numFailed}
-		case shared.SSIM:
-			index, numFailed, img = algos.SSIM(set)
-			result = shared.ResultData{Comparison: string(shared.SSIM), Index: index, NumFailed: numFailed}
-		case shared.MSE:
-			index, numFailed, img = algos.MSE(set)
-			result = shared.ResultData{Comparison: string(shared.MSE), Index: index, NumFailed: numFailed}
-		default:
-			return shared.Comparison{}, fmt.Errorf("comparison type \"%v\" not supported", c)
+	r, err := imagecompare.Compare(ctx, set.ImageA, set.ImageB, compareOptions(set.Data))
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+
+	for i := range r.Results {
+		if len(set.Data.ExportDest) > 0 {
+			r.Results[i].Image = r.Results[i].Comparison + "." + set.Data.DiffFormat
 		}
 
 		if debug {
-			fmt.Printf("%s comparison: %f\n", result.Comparison, result.Index)
+			fmt.Printf("%s comparison: %f\n", r.Results[i].Comparison, r.Results[i].Index)
+		}
+	}
+
+	return newComparison(ctx, set, r)
+}
+
+// CompareIdentical scores byte-identical sources as a perfect match without
+// running the comparators, the diff images are blank.
+func CompareIdentical(ctx context.Context, set utils.CompareSet, bounds image.Rectangle) (shared.Comparison, error) {
+	if len(set.Data.Comparisons) == 0 {
+		return shared.Comparison{}, fmt.Errorf("no comparison type set")
+	}
+
+	r := imagecompare.Identical(bounds, compareOptions(set.Data))
+	if len(set.Data.ExportDest) > 0 {
+		for i := range r.Results {
+			r.Results[i].Image = r.Results[i].Comparison + "." + set.Data.DiffFormat
+		}
+	}
+
+	return newComparison(ctx, set, r)
+}
+
+func newComparison(ctx context.Context, set utils.CompareSet, r imagecompare.Result) (shared.Comparison, error) {
+	if err := ctx.Err(); err != nil {
+		return shared.Comparison{}, err
+	}
+
+	comparison := pairComparison(set)
+	comparison.Results = r.Results
+	comparison.Errors = r.Errors
+	comparison.Reasons = r.Reasons
+	comparison.Passed = r.Passed
+
+	if len(set.Data.ExportDest) > 0 {
+		comparison.Visualizations = visualizationFiles(set.Data.Visualizations, r.Results)
+		if err := export(set, r.Diffs, comparison); err != nil {
+			return shared.Comparison{}, err
+		}
+	}
+
+	return comparison, nil
+}
+
+// FailedComparison records a pair that could not be compared, its meta.json
+// only holds the error.
+func FailedComparison(set utils.CompareSet, err error) shared.Comparison {
+	comparison := pairComparison(set)
+	comparison.Results = []shared.ResultData{}
+	comparison.Errors = []string{err.Error()}
+
+	if len(set.Data.ExportDest) > 0 {
+		if err := writeMeta(comparison); err != nil {
+			comparison.Errors = append(comparison.Errors, err.Error())
 		}
-		results = append(results, result)
-		images = append(images, img)
 	}
 
-	comparison := shared.Comparison{
-		Location: set.Data.ExportDest,
-		SourceA:  filepath.Base(set.Data.SourceA),
-		SourceB:  filepath.Base(set.Data.SourceB),
-		Results:  results,
+	return comparison
+}
+
+// missingComparison records a file or directory that only exists on one
+// side at the location its comparison would have had.
+func missingComparison(m Missing, passed bool) shared.Comparison {
+	comparison := shared.NewComparison("compare")
+	comparison.Location = m.Location
+	comparison.OnlyIn = m.OnlyIn
+	comparison.Results = []shared.ResultData{}
+	comparison.Passed = passed
+
+	path := m.Path
+	if abs, err := filepath.Abs(m.Path); err == nil {
+		path = abs
+	}
+	if m.OnlyIn == "A" {
+		comparison.SourceA, comparison.SourceAPath = filepath.Base(m.Path), path
+	} else {
+		comparison.SourceB, comparison.SourceBPath = filepath.Base(m.Path), path
+	}
+
+	return comparison
+}
+
+// writeMissing writes the meta.json of m and a copy of a missing file, so
+// result trees list it next to the pairs of the same directory.
+func writeMissing(m Missing, passed bool) error {
+	comparison := missingComparison(m, passed)
+
+	if err := os.MkdirAll(m.Location, os.ModePerm); err != nil {
+		return err
+	}
+	if !m.Dir {
+		name := comparison.SourceA + comparison.SourceB
+		if err := copy(m.Path, filepath.Join(m.Location, name)); err != nil {
+			return err
+		}
 	}
 
+	return writeMeta(comparison)
+}
+
+// pairComparison fills in everything that identifies the pair.
+func pairComparison(set utils.CompareSet) shared.Comparison {
+	comparison := shared.NewComparison("compare")
+	comparison.Location = set.Data.ExportDest
+	comparison.SourceA = filepath.Base(set.Data.SourceA)
+	comparison.SourceB = filepath.Base(set.Data.SourceB)
+	comparison.SourceAInfo = set.InfoA
+	comparison.SourceBInfo = set.InfoB
+	comparison.SourceAHash = set.HashA
+	comparison.SourceBHash = set.HashB
+	comparison.Config = configString(set.Data)
+
 	if comparison.SourceA == comparison.SourceB {
 		ext := filepath.Ext(comparison.SourceA)
 		comparison.SourceA = strings.TrimSuffix(comparison.SourceA, ext) + "_A" + ext
@@ -128,11 +214,13 @@ func Compare(set utils.CompareSet) (shared.Comparison, error) {
 		comparison.SourceB = strings.TrimSuffix(comparison.SourceB, ext) + "_B" + ext
 	}
 
-	if len(set.Data.ExportDest) > 0 {
-		if err := export(set.Data, images, comparison); err != nil {
-			return shared.Comparison{}, err
-		}
+	// Absolute paths let approve find the sources regardless of the cwd.
+	if abs, err := filepath.Abs(set.Data.SourceA); err == nil {
+		comparison.SourceAPath = abs
+	}
+	if abs, err := filepath.Abs(set.Data.SourceB); err == nil {
+		comparison.SourceBPath = abs
 	}
 
-	return comparison, nil
+	return comparison
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"ic/compare/imagecompare"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const configFileName = "imagecompare.json"
+
+// pathSettings are resolved relative to the directory of the config file.
+var pathSettings = []string{"A", "B", "o", "junit", "manifest"}
+
+// overrideSettings can be replaced per path in "overrides".
+var overrideSettings = []string{"c", "min-index", "max-failed", "max-region"}
+
+type configFile struct {
+	path      string
+	settings  map[string][]string
+	overrides []utils.Override
+}
+
+// configValues reads a setting, a scalar or an array of scalars for
+// repeatable flags.
+func configValues(raw json.RawMessage) ([]string, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		list = []json.RawMessage{raw}
+	}
+
+	values := []string{}
+	for _, r := range list {
+		d := json.NewDecoder(bytes.NewReader(r))
+		d.UseNumber()
+
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		switch v := v.(type) {
+		case string:
+			values = append(values, v)
+		case json.Number:
+			values = append(values, v.String())
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		default:
+			return nil, fmt.Errorf("unsupported value %s", r)
+		}
+	}
+
+	return values, nil
+}
+
+// readConfig reads path, or imagecompare.json in the working directory when
+// path is empty and it exists.
+func readConfig(path string) (configFile, error) {
+	cfg := configFile{path: path, settings: map[string][]string{}}
+	if len(path) == 0 {
+		if _, err := os.Stat(configFileName); err != nil {
+			return cfg, nil
+		}
+		cfg.path = configFileName
+	}
+
+	data, err := os.ReadFile(cfg.path)
+	if err != nil {
+		return cfg, err
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return cfg, fmt.Errorf("%s: %v", cfg.path, err)
+	}
+
+	for name, raw := range entries {
+		if name == "overrides" {
+			var overrides []map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &overrides); err != nil {
+				return cfg, fmt.Errorf("%s: overrides: %v", cfg.path, err)
+			}
+			for _, entry := range overrides {
+				o, err := readOverride(entry)
+				if err != nil {
+					return cfg, fmt.Errorf("%s: overrides: %v", cfg.path, err)
+				}
+				cfg.overrides = append(cfg.overrides, o)
+			}
+			continue
+		}
+
+		values, err := configValues(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %s: %v", cfg.path, name, err)
+		}
+
+		if slices.Contains(pathSettings, name) && len(values) == 1 && len(values[0]) > 0 && !filepath.IsAbs(values[0]) {
+			values[0] = filepath.Join(filepath.Dir(cfg.path), values[0])
+		}
+		cfg.settings[name] = values
+	}
+
+	return cfg, nil
+}
+
+func readOverride(entry map[string]json.RawMessage) (utils.Override, error) {
+	o := utils.Override{Settings: map[string]string{}}
+
+	if err := json.Unmarshal(entry["match"], &o.Match); err != nil || len(o.Match) == 0 {
+		return o, fmt.Errorf("override without a match glob")
+	}
+
+	for name, raw := range entry {
+		if name == "match" {
+			continue
+		}
+		if !slices.Contains(overrideSettings, name) {
+			return o, fmt.Errorf("\"%s\" can't be overridden per path", name)
+		}
+
+		values, err := configValues(raw)
+		if err != nil || len(values) != 1 {
+			return o, fmt.Errorf("%s: invalid value %s", name, raw)
+		}
+		o.Settings[name] = values[0]
+	}
+
+	// Catch invalid values before any pair is loaded.
+	data := utils.CompareData{}
+	if err := applyOverride(&data, o.Settings); err != nil {
+		return o, fmt.Errorf("%s: %v", o.Match, err)
+	}
+
+	return o, nil
+}
+
+// applyConfig sets every setting of cfg that was not set on the command line.
+func applyConfig(fs *flag.FlagSet, cfg configFile) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	names := []string{}
+	for name := range cfg.settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" || name == "print-config" {
+			return fmt.Errorf("%s: unknown setting \"%s\"", cfg.path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+
+		for _, v := range cfg.settings[name] {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("%s: %s: %v", cfg.path, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dumpConfig is the -print-config output, every setting after merging the
+// config file and the command line.
+func dumpConfig(fs *flag.FlagSet, overrides []utils.Override) ([]byte, error) {
+	settings := map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		v := f.Value.(flag.Getter).Get()
+		if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		}
+		settings[f.Name] = v
+	})
+
+	if len(overrides) > 0 {
+		list := []map[string]string{}
+		for _, o := range overrides {
+			entry := map[string]string{"match": o.Match}
+			for name, v := range o.Settings {
+				entry[name] = v
+			}
+			list = append(list, entry)
+		}
+		settings["overrides"] = list
+	}
+
+	return json.MarshalIndent(settings, "", "  ")
+}
+
+func applyOverride(data *utils.CompareData, settings map[string]string) error {
+	for name, v := range settings {
+		switch name {
+		case "c":
+			comparisons := shared.GetComparisons(v)
+			if len(comparisons) == 0 {
+				return fmt.Errorf("comparison options \"%s\" not supported", v)
+			}
+			data.Comparisons = comparisons
+		case "min-index":
+			all, perType, err := imagecompare.ParseMinIndex(v)
+			if err != nil {
+				return err
+			}
+			// Typed entries are merged into the inherited ones, the value for
+			// all types is only replaced when the override has one.
+			for _, entry := range strings.Split(v, ",") {
+				if !strings.Contains(entry, "=") {
+					data.MinIndex = all
+				}
+			}
+			merged := map[string]float64{}
+			for name, min := range data.MinIndexes {
+				merged[name] = min
+			}
+			for name, min := range perType {
+				merged[name] = min
+			}
+			data.MinIndexes = merged
+		case "max-failed", "max-region":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s \"%s\"", name, v)
+			}
+			if name == "max-failed" {
+				data.MaxFailed = n
+			} else {
+				data.MaxRegion = n
+			}
+		}
+	}
+	return nil
+}
+
+func overridePath(root string, path string, isDir bool) string {
+	if !isDir {
+		return filepath.Base(path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// applyOverrides applies the overrides whose glob matches the path of a pair
+// relative to the A or B root, later overrides win.
+func applyOverrides(data utils.CompareData, sets []utils.CompareSet) error {
+	for i, s := range sets {
+		relA := overridePath(data.SourceA, s.ImageAPath, data.IsDir)
+		relB := overridePath(data.SourceB, s.ImageBPath, data.IsDir)
+
+		for _, o := range data.Overrides {
+			if !matchGlob(o.Match, relA) && !matchGlob(o.Match, relB) {
+				continue
+			}
+			if err := applyOverride(&sets[i].Data, o.Settings); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"ic/compare/imagecompare/utils"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFile = ".icignore"
+
+// Skipped counts the entries of A and B left out by -include, -exclude and
+// .icignore.
+type Skipped struct {
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+}
+
+// globList is a repeatable string flag.
+type globList []string
+
+func (g *globList) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globList) Get() interface{} {
+	return append([]string{}, *g...)
+}
+
+func (g *globList) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+// matchGlob matches a slash separated path against pattern, where ** matches
+// any number of directories. Patterns without a slash match the base name at
+// any depth.
+func matchGlob(pattern string, rel string) bool {
+	pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+	rel = filepath.ToSlash(rel)
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether the entry at path below root is walked. Includes
+// only restrict files so every directory can still be searched for them.
+func included(data utils.CompareData, root string, entry string, isDir bool, skipped *Skipped) bool {
+	rel, err := filepath.Rel(root, entry)
+	if err != nil {
+		rel = entry
+	}
+
+	keep := !matchAny(data.Exclude, rel)
+	if keep && !isDir && len(data.Include) > 0 {
+		keep = matchAny(data.Include, rel)
+	}
+
+	if !keep {
+		if isDir {
+			skipped.Dirs++
+		} else {
+			skipped.Files++
+		}
+	}
+	return keep
+}
+
+// readIgnoreFile returns the patterns of the .icignore in dir, one per line
+// with # comments. A missing file has no patterns.
+func readIgnoreFile(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, ignoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
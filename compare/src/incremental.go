@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configString describes every setting that changes the results of a pair,
+// a result is only reused when it was written with the same configuration.
+func configString(data utils.CompareData) string {
+	comparisons := []string{}
+	for _, c := range data.Comparisons {
+		comparisons = append(comparisons, string(c))
+	}
+
+	minIndexes := []string{}
+	for c, v := range data.MinIndexes {
+		minIndexes = append(minIndexes, fmt.Sprintf("%s=%v", c, v))
+	}
+	sort.Strings(minIndexes)
+
+	return fmt.Sprintf("c=%s f=%s depth=%d exposure=%v viz=%s colormap=%s min-index=%v,%s max-failed=%d max-region=%d no-orientation=%v",
+		strings.Join(comparisons, ","),
+		data.DiffFormat,
+		data.DiffDepth,
+		data.Exposure,
+		strings.Join(data.Visualizations, ","),
+		data.Colormap,
+		data.MinIndex,
+		strings.Join(minIndexes, ","),
+		data.MaxFailed,
+		data.MaxRegion,
+		data.IgnoreOrientation,
+	)
+}
+
+func hashSources(set *utils.CompareSet) error {
+	var err error
+	if set.HashA, err = shared.HashFile(set.ImageAPath); err != nil {
+		return err
+	}
+	if set.HashB, err = shared.HashFile(set.ImageBPath); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reuseComparison returns the existing result of set when its sources and
+// configuration are unchanged and all of its images are still there.
+func reuseComparison(set utils.CompareSet) (shared.Comparison, bool) {
+	c, ok := existingComparison(set)
+	if !ok || c.SourceAHash != set.HashA || c.SourceBHash != set.HashB {
+		return shared.Comparison{}, false
+	}
+	return c, true
+}
+
+// resumeComparison returns the existing result of set when an earlier run
+// with the same configuration completed it, without hashing the sources.
+func resumeComparison(set utils.CompareSet) (shared.Comparison, bool) {
+	c, ok := existingComparison(set)
+	if !ok || len(c.Errors) > 0 {
+		return shared.Comparison{}, false
+	}
+
+	absA, errA := filepath.Abs(set.ImageAPath)
+	absB, errB := filepath.Abs(set.ImageBPath)
+	if errA != nil || errB != nil || c.SourceAPath != absA || c.SourceBPath != absB {
+		return shared.Comparison{}, false
+	}
+	return c, true
+}
+
+// existingComparison reads the meta.json of set, it is written last so its
+// presence means the result is complete.
+func existingComparison(set utils.CompareSet) (shared.Comparison, bool) {
+	c, err := shared.ReadMetaFile(filepath.Join(set.Data.ExportDest, "meta.json"))
+	if err != nil || c.Config != configString(set.Data) {
+		return shared.Comparison{}, false
+	}
+
+	for _, path := range c.ImagePaths() {
+		if _, err := os.Stat(path); err != nil {
+			return shared.Comparison{}, false
+		}
+	}
+
+	c.Dir = ""
+	return c, true
+}
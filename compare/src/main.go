@@ -1,34 +1,137 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"ic/compare/src/utils"
+	"ic/compare/imagecompare"
+	"ic/compare/imagecompare/utils"
 	"ic/shared"
+	"image"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
-    "strings"
+	"regexp"
+	"slices"
+	"strings"
     "sync"
+    "time"
+)
+
+const (
+    exitFailed      = 1
+    exitError       = 2
+    exitInterrupted = 130
 )
 
 type Pair struct {
 	a, b interface{}
 }
 
+// Missing is a file or directory that only exists on one side, Location is
+// where its comparison would have been written.
+type Missing struct {
+	Location string `json:"location"`
+	Path     string `json:"path"`
+	OnlyIn   string `json:"only_in"`
+	Dir      bool   `json:"dir,omitempty"`
+}
+
 func validateArgs(args []string) (utils.CompareData, error) {
 	fs := flag.NewFlagSet("image-compare", flag.ContinueOnError)
 
 	pathA := fs.String("A", "", "Filepath/directory A.")
 	pathB := fs.String("B", "", "Filepath/directory B.")
 	o := fs.String("o", "", "Optional: output directory.")
-	c := fs.String("c", "all", "Optional: Comparison options, [pixel,contrast,quad,ssim,mse].")
+	c := fs.String("c", "all", "Optional: Comparison options, [pixel,contrast,quad,ssim,mse,relative].")
     t := fs.Int("t", 1, "Number of threads to use.")
+    f := fs.String("f", "png", "Optional: Diff image format, [png,pgm,ppm,pam,pfm].")
+    depth := fs.Int("depth", 8, "Optional: Diff image bit depth, [8,16].")
+    exposure := fs.Float64("exposure", 0.0, "Optional: Exposure in stops used to tone map HDR diff images.")
+    viz := fs.String("viz", "", "Optional: Visualizations to export, [heatmap,sidebyside,flicker].")
+    colormap := fs.String("colormap", "viridis", "Optional: Heatmap colormap, [viridis,inferno].")
+    minIndex := fs.String("min-index", "", "Optional: Minimum index for a pair to pass, a value for all types and/or type=value, ex. 0.9,ssim=0.95.")
+    maxFailed := fs.Int("max-failed", -1, "Optional: Maximum num failed points for a pair to pass.")
+    maxRegion := fs.Int("max-region", -1, "Optional: Maximum size in pixels of a connected failed region for a pair to pass.")
+    junit := fs.String("junit", "", "Optional: Path to write a JUnit XML report to.")
+    format := fs.String("format", "", "Optional: Print one record per pair to stdout, [json,jsonl,csv,table].")
+    pairing := fs.String("pair", pairName, "Optional: How files are paired in directory mode, [name,ext,regex].")
+    pairA := fs.String("pair-a", "", "Optional: Regex for files in A, capture groups form the pairing key.")
+    pairB := fs.String("pair-b", "", "Optional: Regex for files in B, capture groups form the pairing key.")
+    manifest := fs.String("manifest", "", "Optional: CSV or JSON file of A,B pairs relative to the A and B directories.")
+    var include, exclude globList
+    fs.Var(&include, "include", "Optional: Glob of files to compare in directory mode, ** matches any directories. Repeatable.")
+    fs.Var(&exclude, "exclude", "Optional: Glob of files and directories to skip in directory mode. Repeatable.")
+    icignore := fs.Bool("icignore", false, "Optional: Skip the patterns listed in .icignore files in the A and B roots.")
+    failFast := fs.Bool("fail-fast", false, "Optional: Stop at the first pair that can't be compared instead of recording the error.")
+    progressMode := fs.String("progress", progressAuto, "Optional: Progress on stderr, [auto,tty,log,json,off], auto updates a line on a terminal and logs periodically otherwise.")
+    timeout := fs.Duration("timeout", 0, "Optional: Maximum time per pair, ex. 30s, the pair is recorded as an error when exceeded.")
+    resume := fs.Bool("resume", false, "Optional: Skip pairs an earlier run with the same settings completed in the output directory.")
+    incremental := fs.Bool("incremental", false, "Optional: Reuse results in the output directory whose sources and settings are unchanged.")
+    missingFails := fs.Bool("missing-fails", false, "Optional: Fail the run when files or directories only exist in A or B.")
+    noOrientation := fs.Bool("no-orientation", false, "Optional: Ignore EXIF orientation of JPEG and TIFF sources.")
+    watchMode := fs.Bool("watch", false, "Optional: Keep running and compare pairs again when their sources change, until Ctrl-C. Requires -o.")
+    watchInterval := fs.Duration("watch-interval", time.Second, "Optional: How often -watch polls the sources.")
+    configPath := fs.String("config", "", "Optional: JSON file with settings by flag name, flags override it. Defaults to imagecompare.json in the working directory when present.")
+    printConfig := fs.Bool("print-config", false, "Optional: Print the settings merged from the config file and flags as JSON and exit.")
 
 	if err := fs.Parse(args); err != nil {
 		return utils.CompareData{}, err
 	}
 
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		return utils.CompareData{}, err
+	}
+	if err := applyConfig(fs, cfg); err != nil {
+		return utils.CompareData{}, err
+	}
+
+	if *printConfig {
+		dump, err := dumpConfig(fs, cfg.overrides)
+		if err != nil {
+			return utils.CompareData{}, err
+		}
+		return utils.CompareData{ConfigDump: dump}, nil
+	}
+
+	if !slices.Contains(shared.EncodeFormats, *f) {
+		return utils.CompareData{}, fmt.Errorf("diff format \"%s\" not supported", *f)
+	}
+
+	if *depth != 8 && *depth != 16 {
+		return utils.CompareData{}, fmt.Errorf("diff bit depth %d not supported", *depth)
+	}
+
+	if *watchInterval <= 0 {
+		return utils.CompareData{}, fmt.Errorf("watch interval must be positive")
+	}
+
+	if !slices.Contains(progressModes, *progressMode) {
+		return utils.CompareData{}, fmt.Errorf("progress \"%s\" not supported", *progressMode)
+	}
+
+	if len(*format) > 0 && !slices.Contains(outputFormats, *format) {
+		return utils.CompareData{}, fmt.Errorf("output format \"%s\" not supported", *format)
+	}
+
+	minAll, minPerType, err := imagecompare.ParseMinIndex(*minIndex)
+	if err != nil {
+		return utils.CompareData{}, err
+	}
+
+	visualizations, err := getVisualizations(*viz)
+	if err != nil {
+		return utils.CompareData{}, err
+	}
+
+	if err := utils.ValidateColormap(*colormap); err != nil {
+		return utils.CompareData{}, err
+	}
+
 	infoA, errA := os.Stat(*pathA)
 	infoB, errB := os.Stat(*pathB)
 	if errA != nil || errB != nil {
@@ -39,6 +142,47 @@ func validateArgs(args []string) (utils.CompareData, error) {
 		return utils.CompareData{}, fmt.Errorf("sources differ, comparing file to directory")
 	}
 
+	if !slices.Contains(pairingModes, *pairing) {
+		return utils.CompareData{}, fmt.Errorf("pairing \"%s\" not supported", *pairing)
+	}
+
+	if len(*manifest) > 0 && !infoA.IsDir() {
+		return utils.CompareData{}, fmt.Errorf("manifest requires A and B directories")
+	}
+
+	if *icignore && infoA.IsDir() {
+		for _, root := range []string{*pathA, *pathB} {
+			patterns, err := readIgnoreFile(root)
+			if err != nil {
+				return utils.CompareData{}, err
+			}
+			exclude = append(exclude, patterns...)
+		}
+	}
+
+	if *incremental && len(*o) == 0 {
+		return utils.CompareData{}, fmt.Errorf("incremental requires an output directory")
+	}
+
+	if *resume && len(*o) == 0 {
+		return utils.CompareData{}, fmt.Errorf("resume requires an output directory")
+	}
+
+	// Unchanged pairs are reused from their meta.json between iterations.
+	if *watchMode && len(*o) == 0 {
+		return utils.CompareData{}, fmt.Errorf("watch requires an output directory")
+	}
+
+	var regexA, regexB *regexp.Regexp
+	if *pairing == pairRegex {
+		if regexA, err = compilePairRegex(*pairA, "A"); err != nil {
+			return utils.CompareData{}, err
+		}
+		if regexB, err = compilePairRegex(*pairB, "B"); err != nil {
+			return utils.CompareData{}, err
+		}
+	}
+
 	data := utils.CompareData{}
 	data.SourceA = *pathA
 	data.SourceB = *pathB
@@ -46,16 +190,54 @@ func validateArgs(args []string) (utils.CompareData, error) {
 	data.ExportDest = *o
 	data.Comparisons = shared.GetComparisons(*c)
     data.Threads = *t
+    data.IgnoreOrientation = *noOrientation
+    data.DiffFormat = *f
+    data.DiffDepth = *depth
+    data.Exposure = *exposure
+    data.Visualizations = visualizations
+    data.Colormap = *colormap
+    data.MinIndex = minAll
+    data.MinIndexes = minPerType
+    data.MaxFailed = *maxFailed
+    data.MaxRegion = *maxRegion
+    data.JUnit = *junit
+    data.Format = *format
+    data.MissingFails = *missingFails
+    data.Pairing = *pairing
+    data.PairRegexA = regexA
+    data.PairRegexB = regexB
+    data.Manifest = *manifest
+    data.Include = include
+    data.Incremental = *incremental
+    data.Resume = *resume
+    data.FailFast = *failFast
+    data.Timeout = *timeout
+    data.Progress = *progressMode
+    data.Watch = *watchMode
+    data.WatchInterval = *watchInterval
+    data.Overrides = cfg.overrides
+    data.Exclude = exclude
 
 	return data, nil
 }
 
 
-func load(data utils.CompareData) ([]utils.CompareSet, error) {
+func load(data utils.CompareData) ([]utils.CompareSet, []Missing, Skipped, error) {
+    var sets []utils.CompareSet
+    var missing []Missing
+    var skipped Skipped
+    var err error
+
     if isFileComparison(data) {
-        return handleFileComparison(data)
+        sets, err = handleFileComparison(data)
+    } else {
+        sets, missing, skipped, err = handleDirectoryComparison(data)
+    }
+    if err != nil {
+        return sets, missing, skipped, err
     }
-    return handleDirectoryComparison(data)
+
+    return sets, missing, skipped, applyOverrides(data, sets)
 }
 
 func isFileComparison(data utils.CompareData) bool {
@@ -89,41 +271,80 @@ func handleFileComparison(data utils.CompareData) ([]utils.CompareSet, error) {
     
 }
 
-func walkSubdirectories(dirA, dirB, outDir string, allPairs *[]Pair) error {
-    thesePairs := compareFilesInDirectories(dirA, dirB, outDir)
+func walkSubdirectories(data utils.CompareData, dirA, dirB, outDir string, allPairs *[]Pair, missing *[]Missing, skipped *Skipped) error {
+    thesePairs, theseMissing, err := compareFilesInDirectories(data, dirA, dirB, outDir, skipped)
+    if err != nil {
+        return err
+    }
     *allPairs = append(*allPairs, thesePairs...)
+    *missing = append(*missing, theseMissing...)
 
-    subdirsA, err := os.ReadDir(dirA)
+    entriesA, err := os.ReadDir(dirA)
     if err != nil {
         return err
     }
-    subdirsB, err := os.ReadDir(dirB)
+    entriesB, err := os.ReadDir(dirB)
     if err != nil {
         return err
     }
 
+    subdirsA := []os.DirEntry{}
+    for _, entry := range entriesA {
+        if entry.IsDir() && included(data, data.SourceA, filepath.Join(dirA, entry.Name()), true, skipped) {
+            subdirsA = append(subdirsA, entry)
+        }
+    }
+    subdirsB := []os.DirEntry{}
+    for _, entry := range entriesB {
+        if entry.IsDir() && included(data, data.SourceB, filepath.Join(dirB, entry.Name()), true, skipped) {
+            subdirsB = append(subdirsB, entry)
+        }
+    }
+
+    subdirsAMap := mapSubdirectories(subdirsA, dirA)
     subdirsBMap := mapSubdirectories(subdirsB, dirB)
 
+    for _, entryB := range subdirsB {
+        if _, exists := subdirsAMap[entryB.Name()]; entryB.IsDir() && !exists {
+            *missing = append(*missing, Missing{
+                Location: filepath.Join(outDir, entryB.Name()),
+                Path:     filepath.Join(dirB, entryB.Name()),
+                OnlyIn:   "B",
+                Dir:      true,
+            })
+        }
+    }
+
     for _, entryA := range subdirsA {
         if entryA.IsDir() {
             if matchingDirB, exists := subdirsBMap[entryA.Name()]; exists {
                 subOutDir := filepath.Join(outDir, entryA.Name())
 
-                if len(subOutDir) > 0 {
+                if len(data.ExportDest) > 0 {
                     if err := os.MkdirAll(subOutDir, os.ModePerm); err != nil {
                         return err
                     }
                 }
 
                 err := walkSubdirectories(
+                    data,
                     filepath.Join(dirA, entryA.Name()),
                     matchingDirB,
                     subOutDir,
                     allPairs,
+                    missing,
+                    skipped,
                 )
                 if err != nil {
                     return err
                 }
+            } else {
+                *missing = append(*missing, Missing{
+                    Location: filepath.Join(outDir, entryA.Name()),
+                    Path:     filepath.Join(dirA, entryA.Name()),
+                    OnlyIn:   "A",
+                    Dir:      true,
+                })
             }
         }
     }
@@ -131,19 +352,27 @@ func walkSubdirectories(dirA, dirB, outDir string, allPairs *[]Pair) error {
     return nil
 }
 
-func handleDirectoryComparison(data utils.CompareData) ([]utils.CompareSet, error) {
+func handleDirectoryComparison(data utils.CompareData) ([]utils.CompareSet, []Missing, Skipped, error) {
     pairs := []Pair{}
+    missing := []Missing{}
+    skipped := Skipped{}
 
     if len(data.ExportDest) > 0 {
         os.MkdirAll(data.ExportDest, os.ModePerm)
     }
 
-    err := walkSubdirectories(data.SourceA, data.SourceB, data.ExportDest, &pairs)
+    var err error
+    if len(data.Manifest) > 0 {
+        pairs, missing, err = manifestPairs(data)
+    } else {
+        err = walkSubdirectories(data, data.SourceA, data.SourceB, data.ExportDest, &pairs, &missing, &skipped)
+    }
     if err != nil {
-        return nil, err
+        return nil, nil, skipped, err
     }
 
-    return loadPairsIntoSets(pairs, data)
+    sets, err := loadPairsIntoSets(pairs, data)
+    return sets, missing, skipped, err
 }
 
 func mapSubdirectories(subdirs []os.DirEntry, basePath string) map[string]string {
@@ -156,43 +385,76 @@ func mapSubdirectories(subdirs []os.DirEntry, basePath string) map[string]string
     return subdirsMap
 }
 
+// pairFiles maps the pairing key of every image in dir to its path.
+func pairFiles(data utils.CompareData, root, dir string, side string, skipped *Skipped) (map[string]string, []string, error) {
+    files, _ := os.ReadDir(dir)
+
+    paths := make(map[string]string)
+    keys := []string{}
+    for _, file := range files {
+        path := filepath.Join(dir, file.Name())
+        if file.IsDir() || !included(data, root, path, false, skipped) || !shared.IsImageFile(path) {
+            continue
+        }
+
+        key, ok := pairKey(data, side, file.Name())
+        if !ok {
+            continue
+        }
+        if other, exists := paths[key]; exists {
+            return nil, nil, fmt.Errorf("ambiguous pairing, %s and %s have the same key", other, path)
+        }
 
-func isImageFile(fileName string) bool {
-    ext := strings.ToLower(filepath.Ext(fileName))
-    switch ext {
-    case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".webp":
-        return true
-    default:
-        return false
+        paths[key] = path
+        keys = append(keys, key)
     }
+    return paths, keys, nil
 }
 
-func compareFilesInDirectories(dirA, dirB, outputDir string) []Pair {
-    filesA, _ := os.ReadDir(dirA)
-    filesB, _ := os.ReadDir(dirB)
-    
-    filesBMap := make(map[string]string)
-    for _, fileB := range filesB {
-        if !fileB.IsDir() {
-            filesBMap[fileB.Name()] = filepath.Join(dirB, fileB.Name())
+func compareFilesInDirectories(data utils.CompareData, dirA, dirB, outputDir string, skipped *Skipped) ([]Pair, []Missing, error) {
+    filesAMap, keysA, err := pairFiles(data, data.SourceA, dirA, "A", skipped)
+    if err != nil {
+        return nil, nil, err
+    }
+    filesBMap, keysB, err := pairFiles(data, data.SourceB, dirB, "B", skipped)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    missingFile := func(path, onlyIn string) Missing {
+        name := filepath.Base(path)
+        return Missing{
+            Location: filepath.Join(outputDir, strings.TrimSuffix(name, filepath.Ext(name))),
+            Path:     path,
+            OnlyIn:   onlyIn,
         }
     }
 
     var pairs []Pair
-    for _, fileA := range filesA {
-        if !fileA.IsDir() && isImageFile(fileA.Name()) {
-            if matchingFileB, exists := filesBMap[fileA.Name()]; exists {
+    var missing []Missing
+    for _, key := range keysA {
+        pathA := filesAMap[key]
+        if matchingFileB, exists := filesBMap[key]; exists {
+            if len(data.ExportDest) > 0 {
                 os.MkdirAll(outputDir, os.ModePerm)
-                
-                pairs = append(pairs, Pair{
-                    a: filepath.Join(dirA, fileA.Name()),
-                    b: matchingFileB,
-                })
-                
             }
+            
+            pairs = append(pairs, Pair{
+                a: pathA,
+                b: matchingFileB,
+            })
+            
+        } else {
+            missing = append(missing, missingFile(pathA, "A"))
+        }
+    }
+
+    for _, key := range keysB {
+        if _, exists := filesAMap[key]; !exists {
+            missing = append(missing, missingFile(filesBMap[key], "B"))
         }
     }
-    return pairs
+    return pairs, missing, nil
 }
 
 func loadPairsIntoSets(pairs []Pair, data utils.CompareData) ([]utils.CompareSet, error) {
@@ -224,13 +486,17 @@ func loadPairsIntoSets(pairs []Pair, data utils.CompareData) ([]utils.CompareSet
             return nil, fmt.Errorf("failed to compute relative path for %s: %v", p.a, err)
         }
 
-        dirPart := filepath.Dir(relativePath)
-        filePart := filepath.Base(relativePath)
-        baseName := filePart[:len(filePart)-len(filepath.Ext(filePart))]
-        finalExportPath := filepath.Join(data.ExportDest, dirPart, baseName)
+        // Without -o nothing is exported, not even relative to the working directory.
+        finalExportPath := ""
+        if len(data.ExportDest) > 0 {
+            dirPart := filepath.Dir(relativePath)
+            filePart := filepath.Base(relativePath)
+            baseName := filePart[:len(filePart)-len(filepath.Ext(filePart))]
+            finalExportPath = filepath.Join(data.ExportDest, dirPart, baseName)
 
-        if err := os.MkdirAll(finalExportPath, os.ModePerm); err != nil {
-            return nil, fmt.Errorf("failed to create directory %s: %v", finalExportPath, err)
+            if err := os.MkdirAll(finalExportPath, os.ModePerm); err != nil {
+                return nil, fmt.Errorf("failed to create directory %s: %v", finalExportPath, err)
+            }
         }
 
         localData := data
@@ -252,65 +518,344 @@ func loadPairsIntoSets(pairs []Pair, data utils.CompareData) ([]utils.CompareSet
 
 
 
+// fatal exits with exitError so runtime errors can be told apart from
+// failing pairs.
+func fatal(err error) {
+    log.Println(err)
+    os.Exit(exitError)
+}
+
 func run(args []string) []shared.Comparison {
+    return runSummary(args).Comparisons
+}
+
+// comparePair loads and compares one pair. Byte-identical sources are not
+// decoded, completed pairs are reused from an earlier run with -resume and
+// unchanged ones with -incremental.
+func comparePair(ctx context.Context, s utils.CompareSet) (shared.Comparison, bool, error) {
+    if s.Data.Resume {
+        if c, ok := resumeComparison(s); ok {
+            return c, true, nil
+        }
+    }
+
+    if err := hashSources(&s); err != nil {
+        return shared.Comparison{}, false, err
+    }
+    if err := ctx.Err(); err != nil {
+        return shared.Comparison{}, false, err
+    }
+
+    if s.Data.Incremental {
+        if c, ok := reuseComparison(s); ok {
+            return c, true, nil
+        }
+    }
+
+    loadOptions := shared.LoadOptions{IgnoreOrientation: s.Data.IgnoreOrientation}
+
+    if s.HashA == s.HashB {
+        cfg, info, err := shared.ReadImageInfo(s.ImageAPath, loadOptions)
+        if err != nil {
+            return shared.Comparison{}, false, err
+        }
+        s.InfoA = info
+        s.InfoB = info
+
+        // Visualizations draw the sources, so only they need A decoded.
+        if len(s.Data.ExportDest) > 0 && len(s.Data.Visualizations) > 0 {
+            img, _, err := shared.LoadImageInfo(s.ImageAPath, loadOptions)
+            if err != nil {
+                return shared.Comparison{}, false, err
+            }
+            s.ImageA = img
+            s.ImageB = img
+        }
+
+        c, err := CompareIdentical(ctx, s, image.Rect(0, 0, cfg.Width, cfg.Height))
+        return c, false, err
+    }
+
+    imgA, infoA, err := shared.LoadImageInfo(s.ImageAPath, loadOptions)
+    if err != nil {
+        return shared.Comparison{}, false, err
+    }
+    imgB, infoB, err := shared.LoadImageInfo(s.ImageBPath, loadOptions)
+    if err != nil {
+        return shared.Comparison{}, false, err
+    }
+    if err := ctx.Err(); err != nil {
+        return shared.Comparison{}, false, err
+    }
+
+    s.ImageA = imgA
+    s.ImageB = imgB
+    s.InfoA = infoA
+    s.InfoB = infoB
+
+    c, err := Compare(ctx, s)
+    return c, false, err
+}
+
+func runSummary(args []string) RunSummary {
+    summary, err := runContext(context.Background(), args)
+    if err != nil {
+        fatal(err)
+    }
+    return summary
+}
+
+// runContext stops scheduling pairs once ctx is cancelled, pairs in flight
+// abort at the next row and are reported as unfinished. A -dump-config run
+// only returns the settings in Data.ConfigDump.
+func runContext(ctx context.Context, args []string) (RunSummary, error) {
     compareData, err := validateArgs(args)
     if err != nil {
-        log.Fatal(err)
+        return RunSummary{}, err
     }
 
-    compareSets, err := load(compareData)
+    if compareData.ConfigDump != nil {
+        return RunSummary{Data: compareData}, nil
+    }
+
+    compareSets, missing, skipped, err := load(compareData)
+    if err != nil {
+        return RunSummary{}, err
+    }
+
+    reporter := newProgress(compareData.Progress, len(compareSets))
+
+    summary, err := compareAll(ctx, compareData, compareSets, reporter)
     if err != nil {
-        log.Fatal(err)
+        return RunSummary{}, err
     }
+    summary.Missing = missing
+    summary.Skipped = skipped
+
+    if err := writeOutputs(summary); err != nil {
+        return RunSummary{}, err
+    }
+
+    return summary, nil
+}
+
+// compareAll compares the sets with data.Threads in parallel. Pairs that were
+// not started or were aborted when ctx is done are left unfinished. With
+// -fail-fast the first failing pair cancels the others and is returned as the
+// error.
+func compareAll(ctx context.Context, data utils.CompareData, compareSets []utils.CompareSet, reporter *progress) (RunSummary, error) {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    var failOnce sync.Once
+    var failErr error
 
-    sem := make(chan struct{}, compareData.Threads)
+    sem := make(chan struct{}, data.Threads)
 
     comparisons := make([]shared.Comparison, len(compareSets))
+    durations := make([]time.Duration, len(compareSets))
+    reused := make([]bool, len(compareSets))
+    finished := make([]bool, len(compareSets))
 
     var wg sync.WaitGroup
 
     for i, s := range compareSets {
+        select {
+        case sem <- struct{}{}:
+        case <-ctx.Done():
+        }
+        if ctx.Err() != nil {
+            break
+        }
+
         wg.Add(1)
-        sem <- struct{}{}
 
         go func(i int, s utils.CompareSet) {
             defer wg.Done()
             defer func() { <-sem }()
 
-            imgA, err := shared.LoadImage(s.ImageAPath)
-            if err != nil {
-                log.Fatal(err)
-            }
-            imgB, err := shared.LoadImage(s.ImageBPath)
-            if err != nil {
-                log.Fatal(err)
-            }
+            start := time.Now()
 
-            s.ImageA = imgA
-            s.ImageB = imgB
+            pairCtx := ctx
+            if s.Data.Timeout > 0 {
+                var cancel context.CancelFunc
+                pairCtx, cancel = context.WithTimeout(ctx, s.Data.Timeout)
+                defer cancel()
+            }
 
-            c, err := Compare(s)
+            c, wasReused, err := comparePair(pairCtx, s)
             if err != nil {
-                log.Fatal(err)
+                if ctx.Err() != nil {
+                    return
+                }
+                if errors.Is(err, context.DeadlineExceeded) {
+                    err = fmt.Errorf("timed out after %v", s.Data.Timeout)
+                }
+                if s.Data.FailFast {
+                    failOnce.Do(func() {
+                        failErr = err
+                        cancel()
+                    })
+                    return
+                }
+                c = FailedComparison(s, err)
             }
 
             comparisons[i] = c
+            reused[i] = wasReused
+            durations[i] = time.Since(start)
+            finished[i] = true
+
+            reporter.Pair(c)
 
         }(i, s)
     }
 
     wg.Wait()
+    reporter.Finish()
+
+    if failErr != nil {
+        return RunSummary{}, failErr
+    }
+
+    for i, s := range compareSets {
+        if !finished[i] {
+            comparisons[i] = pairComparison(s)
+        }
+    }
+
+    return RunSummary{
+        Data:        data,
+        Sets:        compareSets,
+        Comparisons: comparisons,
+        Durations:   durations,
+        Reused:      reused,
+        Finished:    finished,
+    }, nil
+}
 
-    return comparisons
+// writeOutputs writes the JUnit report and summary.json of a run.
+func writeOutputs(summary RunSummary) error {
+    if len(summary.Data.JUnit) > 0 {
+        cases := []shared.TestCase{}
+        for i, c := range summary.Comparisons {
+            cases = append(cases, shared.TestCase{
+                Comparison: c,
+                Failures:   c.Reasons,
+                Errors:     c.Errors,
+                Skipped:    !summary.Finished[i],
+                Seconds:    summary.Durations[i].Seconds(),
+            })
+        }
+
+        if err := shared.WriteJUnit(summary.Data.JUnit, "compare", cases); err != nil {
+            return err
+        }
+    }
+
+    if len(summary.Data.ExportDest) > 0 && summary.Data.IsDir {
+        for _, m := range summary.Missing {
+            if err := writeMissing(m, !summary.Data.MissingFails); err != nil {
+                return err
+            }
+        }
+        if err := writeRunFile(filepath.Join(summary.Data.ExportDest, "summary.json"), summary); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// printNotes lists everything about the run that isn't a pair result.
+func printNotes(w io.Writer, summary RunSummary) {
+	for _, m := range summary.Missing {
+		fmt.Fprintf(w, "only in %s: %s\n", m.OnlyIn, m.Path)
+	}
+	if summary.Skipped.Files > 0 || summary.Skipped.Dirs > 0 {
+		fmt.Fprintf(w, "skipped %d files, %d directories\n", summary.Skipped.Files, summary.Skipped.Dirs)
+	}
+	if n := summary.ReusedCount(); n > 0 {
+		fmt.Fprintf(w, "reused %d completed pairs\n", n)
+	}
+	if unfinished := summary.Unfinished(); len(unfinished) > 0 {
+		fmt.Fprintf(w, "interrupted, %d pairs unfinished:\n", len(unfinished))
+		for _, name := range unfinished {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
 }
 
 func main() {
-	comparisons := run(os.Args[1:])
-	for _, c := range comparisons {
-		if len(c.Location) > 1 {
-			fmt.Println(c.Location)
-		} else {
-			fmt.Println(c.Results)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	summary, err := runContext(ctx, os.Args[1:])
+	if err != nil {
+		fatal(err)
+	}
+	if summary.Data.ConfigDump != nil {
+		fmt.Println(string(summary.Data.ConfigDump))
+		return
+	}
+
+	notes := io.Writer(os.Stdout)
+	if len(summary.Data.Format) > 0 {
+		notes = os.Stderr
+		if err := writeRecords(os.Stdout, summary); err != nil {
+			fatal(err)
+		}
+		printNotes(os.Stderr, summary)
+	} else {
+		for i, c := range summary.Comparisons {
+			if !summary.Finished[i] {
+				continue
+			}
+			if len(c.Location) > 1 {
+				fmt.Println(c.Location)
+			} else {
+				fmt.Println(c.Results)
+			}
+			for _, r := range c.Reasons {
+				fmt.Println("  FAIL:", r)
+			}
+		}
+		printNotes(os.Stdout, summary)
+	}
+
+	if summary.Data.Watch && len(summary.Unfinished()) == 0 {
+		fmt.Fprintf(notes, "watching for changes every %v, Ctrl-C to stop\n", summary.Data.WatchInterval)
+		summary = watch(ctx, notes, summary)
+	}
+	stop()
+
+	if len(summary.Unfinished()) > 0 {
+		os.Exit(exitInterrupted)
+	}
+
+	errored := 0
+	for _, c := range summary.Comparisons {
+		if len(c.Errors) == 0 {
+			continue
+		}
+		if errored == 0 {
+			fmt.Fprintln(os.Stderr, "errors:")
+		}
+		errored++
+		for _, e := range c.Errors {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", c.Name(), e)
+		}
+	}
+	if errored > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d pairs had errors\n", errored, len(summary.Comparisons))
+		os.Exit(exitError)
+	}
+
+	if summary.Data.MissingFails && len(summary.Missing) > 0 {
+		os.Exit(exitFailed)
+	}
+
+	for _, c := range summary.Comparisons {
+		if !c.Passed {
+			os.Exit(exitFailed)
 		}
 	}
 }
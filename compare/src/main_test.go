@@ -1,7 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"ic/compare/imagecompare/utils"
+	"ic/compare/imagetest"
+	"ic/shared"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestPixelMatch(t *testing.T) {
@@ -229,8 +243,8 @@ func TestAll(t *testing.T) {
 		t.Errorf("SSIM compare test failed, compare value was %v, expected value -1", comparisons[0].Results[3].NumFailed)
 	}
 
-	if comparisons[0].Results[4].Index != 0.9997884516460905 {
-		t.Errorf("MSE compare test failed, compare value was %v, expected value 0.9997884516460905", comparisons[0].Results[4].Index)
+	if comparisons[0].Results[4].Index != 0.9991360325810507 {
+		t.Errorf("MSE compare test failed, compare value was %v, expected value 0.9991360325810507", comparisons[0].Results[4].Index)
 	}
 
 	if comparisons[0].Results[4].NumFailed != -1 {
@@ -259,3 +273,944 @@ func TestPixelDir(t *testing.T) {
 		t.Errorf("Pixel directory test failed, compare value was %v, expected value 1.0", comparisons[0].Results[2].Index)
 	}
 }
+
+func TestFormatMatch(t *testing.T) {
+	for _, format := range []string{"jpeg", "gif", "bmp", "tiff"} {
+		ext := format
+		if format == "jpeg" {
+			ext = "jpg"
+		}
+
+		img, info, err := shared.LoadImageInfo("../../testAssets/white."+ext, shared.LoadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imagetest.AssertImageMatches(t, img, "testdata/white.png")
+
+		if info.Format != format {
+			t.Errorf("Format %s compare test failed, decoder was %v", format, info.Format)
+		}
+
+		if info.BitDepth != 8 {
+			t.Errorf("Format %s compare test failed, bit depth was %v, expected value 8", format, info.BitDepth)
+		}
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	img, info, err := shared.LoadImageInfo("../../testAssets/orientB.jpg", shared.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imagetest.AssertImageMatches(t, img, "testdata/orient.png", imagetest.Comparisons(shared.Contrast))
+
+	if info.Orientation != 6 {
+		t.Errorf("Orientation compare test failed, orientation was %v, expected value 6", info.Orientation)
+	}
+}
+
+func TestOrientationDisabled(t *testing.T) {
+	args := []string{"-A", "../../testAssets/orientA.png", "-B", "../../testAssets/orientB.jpg", "-c", "contrast", "-no-orientation"}
+
+	comparisons := run(args)
+
+	// Without the rotation the sources have different sizes.
+	if len(comparisons[0].Errors) != 1 || !strings.Contains(comparisons[0].Errors[0], "sizes differ") {
+		t.Errorf("Orientation disabled test failed, expected a size error, got %v", comparisons[0].Errors)
+	}
+}
+
+func TestNetpbmMatch(t *testing.T) {
+	for _, format := range []string{"ppm", "pam"} {
+		img, info, err := shared.LoadImageInfo("../../testAssets/white."+format, shared.LoadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imagetest.AssertImageMatches(t, img, "testdata/white.png")
+
+		if info.Format != format {
+			t.Errorf("Format %s compare test failed, decoder was %v", format, info.Format)
+		}
+	}
+}
+
+func TestGray16Diff(t *testing.T) {
+	args := []string{"-A", "../../testAssets/gray16A.pgm", "-B", "../../testAssets/gray16B.pgm", "-c", "pixel"}
+
+	comparisons := run(args)
+
+	if comparisons[0].Results[0].Index != 0.0 {
+		t.Errorf("16-bit compare test failed, compare value was %v, expected value 0.0", comparisons[0].Results[0].Index)
+	}
+
+	if comparisons[0].SourceAInfo.BitDepth != 16 {
+		t.Errorf("16-bit compare test failed, bit depth was %v, expected value 16", comparisons[0].SourceAInfo.BitDepth)
+	}
+}
+
+func TestPFMDiff(t *testing.T) {
+	args := []string{"-A", "../../testAssets/floatA.pfm", "-B", "../../testAssets/floatB.pfm", "-c", "pixel"}
+
+	comparisons := run(args)
+
+	if comparisons[0].Results[0].Index != 0.0 {
+		t.Errorf("PFM compare test failed, compare value was %v, expected value 0.0", comparisons[0].Results[0].Index)
+	}
+
+	if comparisons[0].SourceAInfo.BitDepth != 32 {
+		t.Errorf("PFM compare test failed, bit depth was %v, expected value 32", comparisons[0].SourceAInfo.BitDepth)
+	}
+}
+
+func TestDiffFormat(t *testing.T) {
+	out := t.TempDir()
+	args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/black.png", "-c", "contrast", "-o", out, "-f", "pgm"}
+
+	comparisons := run(args)
+
+	if comparisons[0].Results[0].Image != "contrast.pgm" {
+		t.Fatalf("Diff format test failed, diff image was %v, expected contrast.pgm", comparisons[0].Results[0].Image)
+	}
+
+	_, info, err := shared.LoadImageInfo(filepath.Join(out, "contrast.pgm"), shared.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Format != "pgm" {
+		t.Errorf("Diff format test failed, decoder was %v, expected pgm", info.Format)
+	}
+}
+
+func TestMSE16(t *testing.T) {
+	args := []string{"-A", "../../testAssets/gray16A.pgm", "-B", "../../testAssets/gray16B.pgm", "-c", "mse"}
+
+	comparisons := run(args)
+
+	if comparisons[0].Results[0].Index >= 1.0 {
+		t.Errorf("16-bit MSE test failed, compare value was %v, expected value < 1.0", comparisons[0].Results[0].Index)
+	}
+}
+
+func TestDiffDepth(t *testing.T) {
+	for _, depth := range []int{8, 16} {
+		out := t.TempDir()
+		args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/black.png", "-c", "contrast", "-o", out, "-depth", strconv.Itoa(depth)}
+
+		run(args)
+
+		_, info, err := shared.LoadImageInfo(filepath.Join(out, "contrast.png"), shared.LoadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.BitDepth != depth {
+			t.Errorf("Diff depth test failed, bit depth was %v, expected value %v", info.BitDepth, depth)
+		}
+	}
+}
+
+func TestHDRRelative(t *testing.T) {
+	args := []string{"-A", "../../testAssets/hdrA.hdr", "-B", "../../testAssets/hdrB.hdr", "-c", "relative"}
+
+	comparisons := run(args)
+
+	if comparisons[0].SourceAInfo.Format != "hdr" || comparisons[0].SourceAInfo.BitDepth != 32 {
+		t.Errorf("HDR compare test failed, source info was %v, expected hdr 32-bit", comparisons[0].SourceAInfo)
+	}
+
+	if math.Abs(comparisons[0].Results[0].Index-0.9146) > 0.0001 {
+		t.Errorf("HDR compare test failed, compare value was %v, expected value 0.9146", comparisons[0].Results[0].Index)
+	}
+
+	if comparisons[0].Results[0].NumFailed != 576 {
+		t.Errorf("HDR compare test failed, compare value was %v, expected value 576", comparisons[0].Results[0].NumFailed)
+	}
+}
+
+func TestHDRExposure(t *testing.T) {
+	out := t.TempDir()
+	args := []string{"-A", "../../testAssets/hdrA.hdr", "-B", "../../testAssets/hdrB.hdr", "-c", "contrast", "-o", out, "-exposure", "-2"}
+
+	run(args)
+
+	img, err := shared.LoadImage(filepath.Join(out, "contrast.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Radiance difference of 0.375, scaled by 2^-2.
+	v, _, _, _ := shared.FloatRGBA(img.At(0, 0))
+	if math.Abs(v-0.09375) > 1.0/255 {
+		t.Errorf("HDR exposure test failed, diff value was %v, expected value 0.09375", v)
+	}
+}
+
+func TestVisualizations(t *testing.T) {
+	out := t.TempDir()
+	args := []string{"-A", "../../testAssets/quadA.png", "-B", "../../testAssets/quadB.png", "-c", "pixel", "-o", out, "-viz", "heatmap,sidebyside,flicker", "-colormap", "inferno"}
+
+	comparisons := run(args)
+
+	if len(comparisons[0].Visualizations) != 3 {
+		t.Fatalf("Visualization test failed, %v visualizations, expected 3", len(comparisons[0].Visualizations))
+	}
+
+	for _, v := range comparisons[0].Visualizations {
+		if _, err := shared.LoadImage(filepath.Join(out, v)); err != nil {
+			t.Errorf("Visualization test failed, could not load %s: %v", v, err)
+		}
+	}
+}
+
+func TestVisualizationInvalid(t *testing.T) {
+	args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/white.png", "-viz", "hologram"}
+
+	if _, err := validateArgs(args); err == nil {
+		t.Error("Visualization test failed, unsupported visualization was accepted")
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/black.png", "-c", "pixel", "-min-index", "0.99", "-junit", path}
+
+	run(args)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `tests="1" failures="1"`) {
+		t.Errorf("JUnit test failed, expected one failing testcase, got:\n%s", data)
+	}
+
+	if !strings.Contains(string(data), `<property name="pixel.index" value="0">`) {
+		t.Errorf("JUnit test failed, pixel index property missing, got:\n%s", data)
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/black.png", "-c", "pixel", "-format", "csv"}
+
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, runSummary(args)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Output format test failed, expected header and one record, got:\n%s", buf.String())
+	}
+
+	if !strings.HasPrefix(lines[0], "source_a,source_b,location,pixel_index,pixel_numfailed") {
+		t.Errorf("Output format test failed, unexpected header %s", lines[0])
+	}
+
+	if !strings.HasPrefix(lines[1], "../../testAssets/white.png,../../testAssets/black.png,,0,") {
+		t.Errorf("Output format test failed, unexpected record %s", lines[1])
+	}
+}
+
+func TestOutputFormatInvalid(t *testing.T) {
+	args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/black.png", "-format", "xml"}
+
+	if _, err := validateArgs(args); err == nil {
+		t.Errorf("Output format test failed, expected error for unsupported format")
+	}
+}
+
+func TestMinIndexPerType(t *testing.T) {
+	args := []string{"-A", "../../testAssets/DirA/screen.png", "-B", "../../testAssets/DirB/screen.png", "-c", "pixel,ssim", "-min-index", "0.5,ssim=0.99"}
+
+	comparisons := run(args)
+	if comparisons[0].Passed {
+		t.Fatalf("Min index test failed, expected pair to fail")
+	}
+
+	if len(comparisons[0].Reasons) != 1 || !strings.HasPrefix(comparisons[0].Reasons[0], "ssim index") {
+		t.Errorf("Min index test failed, expected only ssim to fail, got %v", comparisons[0].Reasons)
+	}
+}
+
+func TestMaxRegion(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"-A", "../../testAssets/DirA/quad.png", "-B", "../../testAssets/DirB/quad.png", "-c", "pixel", "-max-region", "10", "-o", dir}
+
+	comparisons := run(args)
+	if comparisons[0].Results[0].Region != 48 {
+		t.Errorf("Max region test failed, region was %d, expected 48", comparisons[0].Results[0].Region)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"passed": false`) || !strings.Contains(string(data), "pixel failed region 48 above 10") {
+		t.Errorf("Max region test failed, verdict missing from meta.json:\n%s", data)
+	}
+}
+
+func copyAsset(t *testing.T, src string, dst string) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+	out := filepath.Join(root, "out")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "white.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "white.png"))
+	copyAsset(t, "../../testAssets/red.png", filepath.Join(dirA, "red.png"))
+	copyAsset(t, "../../testAssets/blue.png", filepath.Join(dirB, "blue.png"))
+	copyAsset(t, "../../testAssets/red.png", filepath.Join(dirA, "icons", "red.png"))
+
+	summary := runSummary([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-o", out})
+
+	if len(summary.Comparisons) != 1 {
+		t.Fatalf("Missing test failed, %d comparisons, expected 1", len(summary.Comparisons))
+	}
+
+	expected := map[string]Missing{
+		"red":   {Location: filepath.Join(out, "red"), Path: filepath.Join(dirA, "red.png"), OnlyIn: "A"},
+		"blue":  {Location: filepath.Join(out, "blue"), Path: filepath.Join(dirB, "blue.png"), OnlyIn: "B"},
+		"icons": {Location: filepath.Join(out, "icons"), Path: filepath.Join(dirA, "icons"), OnlyIn: "A", Dir: true},
+	}
+	if len(summary.Missing) != len(expected) {
+		t.Fatalf("Missing test failed, got %v", summary.Missing)
+	}
+	for _, m := range summary.Missing {
+		if m != expected[filepath.Base(m.Location)] {
+			t.Errorf("Missing test failed, unexpected entry %+v", m)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"only_in": "B"`) {
+		t.Errorf("Missing test failed, summary.json does not list missing files:\n%s", data)
+	}
+
+	meta, err := shared.ReadMetaFile(filepath.Join(out, "blue", "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.OnlyIn != "B" || meta.SourceB != "blue.png" || len(meta.Results) != 0 {
+		t.Errorf("Missing test failed, unexpected meta.json %+v", meta)
+	}
+	if _, err := os.Stat(filepath.Join(out, "blue", "blue.png")); err != nil {
+		t.Errorf("Missing test failed, source was not copied: %v", err)
+	}
+	if meta, err := shared.ReadMetaFile(filepath.Join(out, "icons", "meta.json")); err != nil || meta.OnlyIn != "A" {
+		t.Errorf("Missing test failed, no meta.json for the directory only in A (%v)", err)
+	}
+
+	records := summary.Records()
+	if len(records) != 4 || records[1].OnlyIn == "" || records[0].OnlyIn != "" {
+		t.Errorf("Missing test failed, unexpected records %+v", records)
+	}
+}
+
+func TestPairRegex(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "foo_expected.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "foo_actual.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "notes.png"))
+
+	summary := runSummary([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-pair", "regex", "-pair-a", `^(.*)_expected\.png$`, "-pair-b", `^(.*)_actual\.png$`, "-o", filepath.Join(root, "out")})
+
+	if len(summary.Sets) != 1 || filepath.Base(summary.Sets[0].ImageBPath) != "foo_actual.png" {
+		t.Fatalf("Pair regex test failed, got %d pairs", len(summary.Sets))
+	}
+	if len(summary.Missing) != 0 {
+		t.Errorf("Pair regex test failed, files not matching the regex were reported missing: %v", summary.Missing)
+	}
+}
+
+func TestPairExt(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "white.png"))
+	copyAsset(t, "../../testAssets/white.bmp", filepath.Join(dirB, "White.bmp"))
+
+	comparisons := run([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-pair", "ext", "-o", filepath.Join(root, "out")})
+
+	if len(comparisons) != 1 || comparisons[0].Results[0].Index != 1.0 {
+		t.Errorf("Pair ext test failed, expected one matching pair, got %v", comparisons)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "sub", "first.png"))
+	copyAsset(t, "../../testAssets/black.png", filepath.Join(dirB, "second.png"))
+	copyAsset(t, "../../testAssets/red.png", filepath.Join(dirA, "orphan.png"))
+
+	for _, manifest := range []struct{ name, content string }{
+		{"pairs.csv", "a,b\nsub/first.png,second.png\norphan.png,gone.png\n"},
+		{"pairs.json", `[{"a": "sub/first.png", "b": "second.png"}, {"a": "orphan.png", "b": "gone.png"}]`},
+	} {
+		path := filepath.Join(root, manifest.name)
+		if err := os.WriteFile(path, []byte(manifest.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		summary := runSummary([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-manifest", path, "-o", filepath.Join(root, "out")})
+
+		if len(summary.Comparisons) != 1 || summary.Comparisons[0].Results[0].Index != 0.0 {
+			t.Errorf("Manifest test failed for %s, expected one differing pair", manifest.name)
+		}
+		if len(summary.Missing) != 1 || summary.Missing[0].OnlyIn != "A" {
+			t.Errorf("Manifest test failed for %s, expected orphan.png to be missing, got %v", manifest.name, summary.Missing)
+		}
+	}
+}
+
+func TestManifestOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "first.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "first.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(root, "outside.png"))
+
+	for _, entry := range []string{"../outside.png", filepath.Join(root, "outside.png")} {
+		path := filepath.Join(root, "pairs.csv")
+		if err := os.WriteFile(path, []byte("first.png,first.png\n"+entry+",first.png\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := validateArgs([]string{"-A", dirA, "-B", dirB, "-manifest", path, "-o", filepath.Join(root, "out")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := load(data); err == nil {
+			t.Errorf("Manifest outside root test failed, no error for %s", entry)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"*.png", "a/b/c.png", true},
+		{".git", "sub/.git", true},
+		{"icons/*.png", "icons/red.png", true},
+		{"icons/*.png", "sub/icons/red.png", false},
+		{"**/icons/*.png", "sub/icons/red.png", true},
+		{"**/icons/*.png", "icons/red.png", true},
+		{"cache/**", "cache/a/b.png", true},
+		{"a/**/b.png", "a/x/y/b.png", true},
+		{"a/**/b.png", "a/x/y/c.png", false},
+	}
+
+	for _, c := range cases {
+		if matchGlob(c.pattern, c.path) != c.match {
+			t.Errorf("Glob test failed, %s matching %s should be %v", c.pattern, c.path, c.match)
+		}
+	}
+}
+
+func TestIncludeExclude(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+
+	for _, dir := range []string{dirA, dirB} {
+		copyAsset(t, "../../testAssets/white.png", filepath.Join(dir, "icons", "white.png"))
+		copyAsset(t, "../../testAssets/white.png", filepath.Join(dir, "icons", "white_thumb.png"))
+		copyAsset(t, "../../testAssets/white.png", filepath.Join(dir, "cache", "white.png"))
+		copyAsset(t, "../../testAssets/white.bmp", filepath.Join(dir, "white.bmp"))
+	}
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, ".git", "white.png"))
+	if err := os.WriteFile(filepath.Join(dirA, ".icignore"), []byte("# vcs\n.git\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := runSummary([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-include", "**/*.png", "-exclude", "cache", "-exclude", "*_thumb.png", "-icignore", "-o", filepath.Join(root, "out")})
+
+	if len(summary.Sets) != 1 || filepath.Base(summary.Sets[0].ImageAPath) != "white.png" {
+		t.Fatalf("Include/exclude test failed, expected only icons/white.png, got %d pairs", len(summary.Sets))
+	}
+	if len(summary.Missing) != 0 {
+		t.Errorf("Include/exclude test failed, skipped entries reported missing: %v", summary.Missing)
+	}
+
+	// Both sides: white.bmp and white_thumb.png, .icignore, cache and .git in A.
+	expected := Skipped{Files: 5, Dirs: 3}
+	if summary.Skipped != expected {
+		t.Errorf("Include/exclude test failed, skipped %+v, expected %+v", summary.Skipped, expected)
+	}
+}
+
+func TestIdentical(t *testing.T) {
+	root := t.TempDir()
+	copyAsset(t, "../../testAssets/screenA.png", filepath.Join(root, "copy.png"))
+
+	identical := run([]string{"-A", "../../testAssets/screenA.png", "-B", filepath.Join(root, "copy.png"), "-o", filepath.Join(root, "out")})
+
+	for _, r := range identical[0].Results {
+		expectedFailed := 0
+		if r.Comparison == "ssim" || r.Comparison == "mse" {
+			expectedFailed = -1
+		}
+		if r.Index != 1.0 || r.NumFailed != expectedFailed {
+			t.Errorf("Identical test failed, %s was %v/%d", r.Comparison, r.Index, r.NumFailed)
+		}
+		if _, err := os.Stat(filepath.Join(root, "out", r.ImageName())); err != nil {
+			t.Errorf("Identical test failed, diff image missing: %v", err)
+		}
+	}
+
+	if identical[0].SourceAHash != identical[0].SourceBHash || identical[0].SourceAInfo.Format != "png" {
+		t.Errorf("Identical test failed, unexpected source info %+v", identical[0])
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+	out := filepath.Join(root, "out")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "white.png"))
+	copyAsset(t, "../../testAssets/black.png", filepath.Join(dirB, "white.png"))
+	copyAsset(t, "../../testAssets/red.png", filepath.Join(dirA, "red.png"))
+	copyAsset(t, "../../testAssets/red.png", filepath.Join(dirB, "red.png"))
+
+	args := []string{"-A", dirA, "-B", dirB, "-c", "pixel", "-o", out, "-incremental"}
+
+	if n := runSummary(args).ReusedCount(); n != 0 {
+		t.Fatalf("Incremental test failed, first run reused %d pairs", n)
+	}
+
+	second := runSummary(args)
+	if n := second.ReusedCount(); n != 2 {
+		t.Errorf("Incremental test failed, second run reused %d pairs, expected 2", n)
+	}
+	if second.Comparisons[1].Results[0].Index != 0.0 {
+		t.Errorf("Incremental test failed, reused result was %v, expected 0", second.Comparisons[1].Results[0].Index)
+	}
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "white.png"))
+	if n := runSummary(args).ReusedCount(); n != 1 {
+		t.Errorf("Incremental test failed, reused %d pairs after changing a source, expected 1", n)
+	}
+
+	if n := runSummary(append(args, "-max-failed", "0")).ReusedCount(); n != 0 {
+		t.Errorf("Incremental test failed, reused %d pairs after changing settings, expected 0", n)
+	}
+}
+
+func TestPairErrors(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "A")
+	dirB := filepath.Join(root, "B")
+	out := filepath.Join(root, "out")
+
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "white.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "white.png"))
+
+	// Header and IHDR only, detected as an image but not decodable.
+	data, err := os.ReadFile("../../testAssets/red.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyAsset(t, "../../testAssets/red.png", filepath.Join(dirA, "broken.png"))
+	if err := os.WriteFile(filepath.Join(dirB, "broken.png"), data[:33], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	comparisons := run([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-o", out})
+	if len(comparisons) != 2 {
+		t.Fatalf("Pair error test failed, %d comparisons, expected 2", len(comparisons))
+	}
+
+	broken, white := comparisons[0], comparisons[1]
+	if len(broken.Errors) != 1 || broken.Passed || !white.Passed {
+		t.Errorf("Pair error test failed, expected only broken.png to error, got %v and %v", broken.Errors, white.Errors)
+	}
+
+	meta, err := os.ReadFile(filepath.Join(out, "broken", "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(meta), `"errors"`) {
+		t.Errorf("Pair error test failed, meta.json has no errors:\n%s", meta)
+	}
+
+	_, err = runContext(context.Background(), []string{"-A", dirA, "-B", dirB, "-c", "pixel", "-fail-fast"})
+	if err == nil {
+		t.Error("Pair error test failed, -fail-fast did not return the error")
+	}
+}
+
+func TestComparatorErrors(t *testing.T) {
+	root := t.TempDir()
+	odd := image.NewGray(image.Rect(0, 0, 3, 3))
+	for i, v := range []uint8{0, 255} {
+		odd.Pix[0] = v
+		f, err := os.Create(filepath.Join(root, strconv.Itoa(i)+".png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(f, odd)
+		f.Close()
+	}
+
+	comparisons := run([]string{"-A", filepath.Join(root, "0.png"), "-B", filepath.Join(root, "1.png"), "-c", "pixel,quad"})
+
+	if len(comparisons[0].Results) != 1 || len(comparisons[0].Errors) != 1 || !strings.HasPrefix(comparisons[0].Errors[0], "quad") {
+		t.Errorf("Comparator error test failed, expected a quad error next to the pixel result, got %v", comparisons[0].Errors)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	args := []string{"-A", "../../testAssets/screenA.png", "-B", "../../testAssets/screenB.png", "-c", "ssim", "-timeout", "1ns"}
+
+	comparisons := run(args)
+	if len(comparisons[0].Errors) != 1 || !strings.HasPrefix(comparisons[0].Errors[0], "timed out") {
+		t.Errorf("Timeout test failed, expected a timeout error, got %v", comparisons[0].Errors)
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	out := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	summary, err := runContext(ctx, []string{"-A", "../../testAssets/DirA", "-B", "../../testAssets/DirB", "-c", "pixel", "-o", out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(summary.Unfinished()); n != 3 {
+		t.Errorf("Cancel test failed, %d unfinished pairs, expected 3", n)
+	}
+
+	metas := shared.FindMetaFiles(out)
+	if len(metas) != 0 {
+		t.Errorf("Cancel test failed, %d meta.json written for unfinished pairs", len(metas))
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"unfinished": [`) {
+		t.Errorf("Cancel test failed, summary.json does not list unfinished pairs:\n%s", data)
+	}
+}
+
+func TestAtomicWrites(t *testing.T) {
+	out := t.TempDir()
+	run([]string{"-A", "../../testAssets/quadA.png", "-B", "../../testAssets/quadB.png", "-viz", "heatmap,flicker", "-o", out})
+
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp") {
+			t.Errorf("Atomic write test failed, temporary file %s left behind", e.Name())
+		}
+		if info, _ := e.Info(); info.Mode().Perm() != 0644 {
+			t.Errorf("Atomic write test failed, %s has mode %v", e.Name(), info.Mode().Perm())
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	out := t.TempDir()
+	args := []string{"-A", "../../testAssets/DirA", "-B", "../../testAssets/DirB", "-c", "pixel", "-o", out}
+
+	run(args)
+
+	// An interrupted pair has no meta.json, its other files may be partial.
+	if err := os.Remove(filepath.Join(out, "screen", "meta.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := runSummary(append(args, "-resume"))
+	if n := summary.ReusedCount(); n != 2 {
+		t.Errorf("Resume test failed, resumed %d pairs, expected 2", n)
+	}
+	if summary.Reused[1] {
+		t.Errorf("Resume test failed, incomplete pair was not compared again")
+	}
+	if _, err := os.Stat(filepath.Join(out, "screen", "meta.json")); err != nil {
+		t.Errorf("Resume test failed, incomplete pair has no meta.json: %v", err)
+	}
+
+	if n := runSummary(append(args, "-resume", "-c", "pixel,mse")).ReusedCount(); n != 0 {
+		t.Errorf("Resume test failed, resumed %d pairs with different settings, expected 0", n)
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressWriter(&buf, progressJSON, 2)
+	p.Pair(shared.Comparison{Location: "a", Passed: true})
+	p.Pair(shared.Comparison{Location: "b", Passed: false})
+	p.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Progress test failed, expected 3 events, got:\n%s", buf.String())
+	}
+
+	var last ProgressEvent
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Event != "done" || last.Done != 2 || last.Total != 2 || last.Failed != 1 {
+		t.Errorf("Progress test failed, unexpected final event %+v", last)
+	}
+	if !strings.Contains(lines[1], `"passed":false`) {
+		t.Errorf("Progress test failed, pair event without verdict: %s", lines[1])
+	}
+}
+
+func TestProgressLog(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressWriter(&buf, progressLog, 2)
+	p.Pair(shared.Comparison{Location: "a", Passed: true})
+	p.Finish()
+
+	if buf.Len() != 0 {
+		t.Errorf("Progress test failed, short run logged:\n%s", buf.String())
+	}
+
+	p = newProgressWriter(&buf, progressLog, 2)
+	p.last = p.last.Add(-logInterval)
+	p.Pair(shared.Comparison{Location: "a", Passed: true})
+	p.Pair(shared.Comparison{Location: "b", Passed: true})
+	p.Finish()
+
+	if n := strings.Count(buf.String(), "progress done="); n != 2 {
+		t.Errorf("Progress test failed, expected a periodic and a final line, got:\n%s", buf.String())
+	}
+}
+
+func TestProgressInvalid(t *testing.T) {
+	args := []string{"-A", "../../testAssets/white.png", "-B", "../../testAssets/black.png", "-progress", "bar"}
+
+	if _, err := validateArgs(args); err == nil {
+		t.Errorf("Progress test failed, expected error for unsupported mode")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "a")
+	dirB := filepath.Join(root, "b")
+	out := filepath.Join(root, "out")
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "x.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "x.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "y.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "y.png"))
+
+	summary := runSummary([]string{"-A", dirA, "-B", dirB, "-c", "pixel", "-max-failed", "0", "-o", out, "-watch"})
+	stamps := sourceStamps(summary.Sets)
+
+	copyAsset(t, "../../testAssets/black.png", filepath.Join(dirB, "x.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirA, "z.png"))
+	copyAsset(t, "../../testAssets/white.png", filepath.Join(dirB, "z.png"))
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dirB, "x.png"), future, future)
+
+	next, stamps, err := watchOnce(context.Background(), summary, stamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var delta bytes.Buffer
+	printDelta(&delta, summary, next)
+	if !strings.Contains(delta.String(), "~ "+filepath.ToSlash(filepath.Join(out, "x"))+": passed -> failed, pixel 1 -> 0") {
+		t.Errorf("Watch test failed, delta was:\n%s", delta.String())
+	}
+	if !strings.Contains(delta.String(), "+ "+filepath.ToSlash(filepath.Join(out, "z"))+": passed") || strings.Contains(delta.String(), "/y") {
+		t.Errorf("Watch test failed, delta was:\n%s", delta.String())
+	}
+
+	meta, err := shared.ReadMetaFile(filepath.Join(out, "x", "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Passed {
+		t.Error("Watch test failed, meta.json of the changed pair was not updated")
+	}
+
+	// Touching a source without changing it reuses its result.
+	os.Chtimes(filepath.Join(dirA, "y.png"), future, future)
+	again, _, err := watchOnce(context.Background(), next, stamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delta.Reset()
+	printDelta(&delta, next, again)
+	if delta.Len() > 0 {
+		t.Errorf("Watch test failed, unexpected delta:\n%s", delta.String())
+	}
+	if again.ReusedCount() != 1 {
+		t.Errorf("Watch test failed, reused %d pairs, expected 1", again.ReusedCount())
+	}
+
+	if _, err := validateArgs([]string{"-A", dirA, "-B", dirB, "-watch"}); err == nil {
+		t.Error("Watch test failed, expected an error without an output directory")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		copyAsset(t, "../../testAssets/white.png", filepath.Join(root, dir, "icons", "x.png"))
+		copyAsset(t, "../../testAssets/white.png", filepath.Join(root, dir, "y.png"))
+	}
+	copyAsset(t, "../../testAssets/quadA.png", filepath.Join(root, "a", "icons", "x.png"))
+	copyAsset(t, "../../testAssets/quadB.png", filepath.Join(root, "b", "icons", "x.png"))
+	copyAsset(t, "../../testAssets/black.png", filepath.Join(root, "b", "y.png"))
+
+	config := filepath.Join(root, "imagecompare.json")
+	err := os.WriteFile(config, []byte(`{
+		"A": "a",
+		"B": "b",
+		"o": "out",
+		"c": "pixel",
+		"max-failed": 1000000,
+		"exclude": ["*.txt"],
+		"overrides": [{"match": "icons/**", "max-failed": 0}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comparisons := run([]string{"-config", config})
+	if len(comparisons) != 2 {
+		t.Fatalf("Config test failed, %d comparisons, expected 2", len(comparisons))
+	}
+	for _, c := range comparisons {
+		icon := strings.HasPrefix(c.SourceA, "x")
+		if c.Passed == icon {
+			t.Errorf("Config test failed, %s passed: %v", c.SourceA, c.Passed)
+		}
+	}
+
+	// Flags override the config file, not the per-path overrides.
+	comparisons = run([]string{"-config", config, "-max-failed", "0"})
+	for _, c := range comparisons {
+		if c.Passed {
+			t.Errorf("Config test failed, %s passed with -max-failed 0", c.SourceA)
+		}
+	}
+
+	data, err := validateArgs([]string{"-config", config, "-print-config", "-t", "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump map[string]interface{}
+	if err := json.Unmarshal(data.ConfigDump, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump["t"] != 4.0 || dump["o"] != filepath.Join(root, "out") || dump["max-failed"] != 1000000.0 || dump["watch-interval"] != "1s" {
+		t.Errorf("Config test failed, dump was %s", data.ConfigDump)
+	}
+	if overrides, ok := dump["overrides"].([]interface{}); !ok || len(overrides) != 1 {
+		t.Errorf("Config test failed, dump was %s", data.ConfigDump)
+	}
+}
+
+func TestOverrideMinIndex(t *testing.T) {
+	inherited := map[string]float64{"pixel": 0.5}
+	data := utils.CompareData{MinIndex: 0.9, MinIndexes: inherited}
+
+	if err := applyOverride(&data, map[string]string{"min-index": "ssim=0.99"}); err != nil {
+		t.Fatal(err)
+	}
+	if data.MinIndex != 0.9 || data.MinIndexes["pixel"] != 0.5 || data.MinIndexes["ssim"] != 0.99 {
+		t.Errorf("Override test failed, typed min index replaced the inherited ones: %v %v", data.MinIndex, data.MinIndexes)
+	}
+	if len(inherited) != 1 {
+		t.Errorf("Override test failed, inherited min indexes were modified: %v", inherited)
+	}
+
+	if err := applyOverride(&data, map[string]string{"min-index": "0.95,pixel=0.8"}); err != nil {
+		t.Fatal(err)
+	}
+	if data.MinIndex != 0.95 || data.MinIndexes["pixel"] != 0.8 || data.MinIndexes["ssim"] != 0.99 {
+		t.Errorf("Override test failed, unexpected min index %v %v", data.MinIndex, data.MinIndexes)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for _, config := range []string{
+		`{"unknown": 1}`,
+		`{"t": "many"}`,
+		`{"overrides": [{"match": "*.png", "t": 2}]}`,
+		`{"overrides": [{"match": "*.png", "max-failed": "x"}]}`,
+		`{"overrides": [{"max-failed": 0}]}`,
+	} {
+		path := filepath.Join(t.TempDir(), "imagecompare.json")
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := validateArgs([]string{"-config", path, "-A", "../../testAssets/white.png", "-B", "../../testAssets/white.png"}); err == nil {
+			t.Errorf("Config invalid test failed, no error for %s", config)
+		}
+	}
+}
+
+func TestMetaSchema(t *testing.T) {
+	out := t.TempDir()
+	run([]string{"-A", "../../testAssets/screenA.png", "-B", "../../testAssets/screenB.png", "-c", "pixel,ssim", "-o", out})
+
+	c, err := shared.ReadMetaFile(filepath.Join(out, "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.SchemaVersion != shared.SchemaVersion || c.Tool != "compare" || len(c.Timestamp) == 0 {
+		t.Errorf("Meta schema test failed, header was %v %v %v", c.SchemaVersion, c.Tool, c.Timestamp)
+	}
+	if c.SourceAInfo.Width == 0 || c.SourceAInfo.Height == 0 || c.SourceBInfo.Width != c.SourceAInfo.Width {
+		t.Errorf("Meta schema test failed, source info was %+v %+v", c.SourceAInfo, c.SourceBInfo)
+	}
+	if !filepath.IsAbs(c.SourceAPath) || len(c.SourceAHash) == 0 {
+		t.Errorf("Meta schema test failed, source A was %v %v", c.SourceAPath, c.SourceAHash)
+	}
+	if c.Results[1].Params["k2"] != 0.03 || c.Results[0].Seconds <= 0 {
+		t.Errorf("Meta schema test failed, results were %+v", c.Results)
+	}
+}
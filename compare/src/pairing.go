@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"ic/compare/imagecompare/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	pairName  = "name"
+	pairExt   = "ext"
+	pairRegex = "regex"
+)
+
+var pairingModes = []string{pairName, pairExt, pairRegex}
+
+// pairKey returns the key files are paired by, files of the same side with
+// the same key are ambiguous. ok is false for files the pairing ignores.
+func pairKey(data utils.CompareData, side string, name string) (string, bool) {
+	switch data.Pairing {
+	case pairExt:
+		return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name))), true
+	case pairRegex:
+		re := data.PairRegexA
+		if side == "B" {
+			re = data.PairRegexB
+		}
+
+		m := re.FindStringSubmatch(name)
+		if m == nil {
+			return "", false
+		}
+		if len(m) == 1 {
+			return m[0], true
+		}
+		return strings.Join(m[1:], "\x00"), true
+	default:
+		return name, true
+	}
+}
+
+func compilePairRegex(expr string, side string) (*regexp.Regexp, error) {
+	if len(expr) == 0 {
+		return nil, fmt.Errorf("regex pairing needs -pair-%s", strings.ToLower(side))
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pair regex for %s: %v", side, err)
+	}
+	return re, nil
+}
+
+type manifestEntry struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// readManifest reads A,B pairs from a JSON array of {"a", "b"} objects or a
+// two column CSV with an optional a,b header.
+func readManifest(path string) ([]manifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []manifestEntry{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("error unmarshalling manifest: %v", err)
+		}
+		return entries, nil
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "a") && strings.EqualFold(record[1], "b") {
+			continue
+		}
+		entries = append(entries, manifestEntry{A: record[0], B: record[1]})
+	}
+	return entries, nil
+}
+
+// resolve joins a manifest path to its root. Paths must stay inside the root
+// since results are written to the same relative path under -o.
+func resolve(root string, path string) (string, error) {
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("manifest path %s is not relative to %s", path, root)
+	}
+	return filepath.Join(root, path), nil
+}
+
+// manifestPairs resolves manifest paths against the A and B directories,
+// entries where one side does not exist are reported as missing.
+func manifestPairs(data utils.CompareData) ([]Pair, []Missing, error) {
+	entries, err := readManifest(data.Manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pairs := []Pair{}
+	missing := []Missing{}
+	for _, e := range entries {
+		pathA, err := resolve(data.SourceA, e.A)
+		if err != nil {
+			return nil, nil, err
+		}
+		pathB, err := resolve(data.SourceB, e.B)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, errA := os.Stat(pathA)
+		_, errB := os.Stat(pathB)
+
+		switch {
+		case errA == nil && errB == nil:
+			pairs = append(pairs, Pair{a: pathA, b: pathB})
+		case errA == nil:
+			missing = append(missing, Missing{Location: exportLocation(data.ExportDest, e.A), Path: pathA, OnlyIn: "A"})
+		case errB == nil:
+			missing = append(missing, Missing{Location: exportLocation(data.ExportDest, e.B), Path: pathB, OnlyIn: "B"})
+		default:
+			return nil, nil, fmt.Errorf("manifest entry %s,%s: neither file exists", e.A, e.B)
+		}
+	}
+
+	return pairs, missing, nil
+}
+
+func exportLocation(exportDest string, relativePath string) string {
+	base := filepath.Base(relativePath)
+	return filepath.Join(exportDest, filepath.Dir(relativePath), strings.TrimSuffix(base, filepath.Ext(base)))
+}
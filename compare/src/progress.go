@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"ic/shared"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	progressAuto = "auto"
+	progressTTY  = "tty"
+	progressLog  = "log"
+	progressJSON = "json"
+	progressOff  = "off"
+)
+
+var progressModes = []string{progressAuto, progressTTY, progressLog, progressJSON, progressOff}
+
+const ttyInterval = 100 * time.Millisecond
+const logInterval = 5 * time.Second
+
+// ProgressEvent is one line of -progress json.
+type ProgressEvent struct {
+	Event    string  `json:"event"`
+	Location string  `json:"location,omitempty"`
+	Passed   *bool   `json:"passed,omitempty"`
+	Done     int     `json:"done"`
+	Total    int     `json:"total"`
+	Failed   int     `json:"failed"`
+	Rate     float64 `json:"pairs_per_second"`
+	ETA      float64 `json:"eta_seconds"`
+}
+
+type progress struct {
+	mu     sync.Mutex
+	w      io.Writer
+	logger *log.Logger
+	mode   string
+	total  int
+	done   int
+	failed int
+	start  time.Time
+	last   time.Time
+	logged bool
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// newProgress reports to stderr, auto picks the updating line on a terminal
+// and periodic log lines otherwise.
+func newProgress(mode string, total int) *progress {
+	if mode == progressAuto {
+		mode = progressLog
+		if isTerminal(os.Stderr) {
+			mode = progressTTY
+		}
+	}
+	return newProgressWriter(os.Stderr, mode, total)
+}
+
+func newProgressWriter(w io.Writer, mode string, total int) *progress {
+	now := time.Now()
+	return &progress{
+		w:      w,
+		logger: log.New(w, "", log.LstdFlags),
+		mode:   mode,
+		total:  total,
+		start:  now,
+		last:   now,
+	}
+}
+
+func (p *progress) event(name string) ProgressEvent {
+	e := ProgressEvent{Event: name, Done: p.done, Total: p.total, Failed: p.failed}
+
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		e.Rate = float64(p.done) / elapsed
+	}
+	if e.Rate > 0 {
+		e.ETA = float64(p.total-p.done) / e.Rate
+	}
+	return e
+}
+
+func formatETA(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// Pair records a finished pair and reports when the mode's interval passed.
+func (p *progress) Pair(c shared.Comparison) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	if !c.Passed {
+		p.failed++
+	}
+
+	switch p.mode {
+	case progressJSON:
+		e := p.event("pair")
+		e.Location = c.Name()
+		e.Passed = &c.Passed
+		p.writeJSON(e)
+	case progressTTY:
+		if time.Since(p.last) >= ttyInterval {
+			p.last = time.Now()
+			p.writeLine()
+		}
+	case progressLog:
+		if time.Since(p.last) >= logInterval {
+			p.last = time.Now()
+			p.logged = true
+			p.writeLog()
+		}
+	}
+}
+
+// Finish writes the final state of the run. Log mode only adds a final line
+// to periodic ones, runs shorter than the interval stay quiet.
+func (p *progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.mode {
+	case progressJSON:
+		p.writeJSON(p.event("done"))
+	case progressTTY:
+		p.writeLine()
+		fmt.Fprintln(p.w)
+	case progressLog:
+		if p.logged {
+			p.writeLog()
+		}
+	}
+}
+
+func (p *progress) writeJSON(e ProgressEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(p.w, string(data))
+}
+
+func (p *progress) writeLine() {
+	e := p.event("")
+	percent := 100.0
+	if e.Total > 0 {
+		percent = 100.0 * float64(e.Done) / float64(e.Total)
+	}
+	fmt.Fprintf(p.w, "\r\033[K%d/%d pairs (%.1f%%), %d failed, %.1f pairs/s, ETA %s", e.Done, e.Total, percent, e.Failed, e.Rate, formatETA(e.ETA))
+}
+
+func (p *progress) writeLog() {
+	e := p.event("")
+	p.logger.Printf("progress done=%d total=%d failed=%d rate=%.1f/s eta=%s", e.Done, e.Total, e.Failed, e.Rate, formatETA(e.ETA))
+}
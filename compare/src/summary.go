@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var outputFormats = []string{"json", "jsonl", "csv", "table"}
+
+type RunSummary struct {
+	Data        utils.CompareData
+	Sets        []utils.CompareSet
+	Comparisons []shared.Comparison
+	Durations   []time.Duration
+	Reused      []bool
+	Finished    []bool
+	Missing     []Missing
+	Skipped     Skipped
+}
+
+// runFile is the run-level summary.json written to the root of a directory
+// comparison.
+type runFile struct {
+	Pairs      int       `json:"pairs"`
+	Failed     int       `json:"failed"`
+	Missing    []Missing `json:"missing"`
+	Skipped    Skipped   `json:"skipped"`
+	Reused     int       `json:"reused"`
+	Errors     int       `json:"errors"`
+	Unfinished []string  `json:"unfinished"`
+}
+
+// Unfinished names the pairs that were not compared because the run was
+// interrupted.
+func (s RunSummary) Unfinished() []string {
+	names := []string{}
+	for i, c := range s.Comparisons {
+		if !s.Finished[i] {
+			names = append(names, c.Name())
+		}
+	}
+	return names
+}
+
+func (s RunSummary) ReusedCount() int {
+	n := 0
+	for _, r := range s.Reused {
+		if r {
+			n++
+		}
+	}
+	return n
+}
+
+func writeRunFile(path string, s RunSummary) error {
+	f := runFile{Pairs: len(s.Comparisons), Missing: s.Missing, Skipped: s.Skipped, Reused: s.ReusedCount(), Unfinished: s.Unfinished()}
+	for i, c := range s.Comparisons {
+		if !s.Finished[i] {
+			continue
+		}
+		if !c.Passed {
+			f.Failed++
+		}
+		if len(c.Errors) > 0 {
+			f.Errors++
+		}
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %v", err)
+	}
+
+	if err := shared.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+
+	return nil
+}
+
+type Record struct {
+	SourceA    string              `json:"source_a"`
+	SourceB    string              `json:"source_b"`
+	Location   string              `json:"location"`
+	Results    []shared.ResultData `json:"results"`
+	Passed     bool                `json:"passed"`
+	Reasons    []string            `json:"reasons"`
+	Reused     bool                `json:"reused"`
+	Unfinished bool                `json:"unfinished"`
+	Duration   float64             `json:"duration_seconds"`
+	Errors     []string            `json:"errors"`
+	OnlyIn     string              `json:"only_in,omitempty"`
+}
+
+func (s RunSummary) Records() []Record {
+	records := []Record{}
+	for i, c := range s.Comparisons {
+		records = append(records, Record{
+			SourceA:    s.Sets[i].ImageAPath,
+			SourceB:    s.Sets[i].ImageBPath,
+			Location:   c.Location,
+			Results:    c.Results,
+			Passed:     c.Passed,
+			Reasons:    append([]string{}, c.Reasons...),
+			Reused:     s.Reused[i],
+			Unfinished: !s.Finished[i],
+			Duration:   s.Durations[i].Seconds(),
+			Errors:     append([]string{}, c.Errors...),
+		})
+	}
+
+	// Files and directories only on one side follow the pairs.
+	for _, m := range s.Missing {
+		r := Record{
+			Location: m.Location,
+			Results:  []shared.ResultData{},
+			Passed:   !s.Data.MissingFails,
+			Reasons:  []string{},
+			Errors:   []string{},
+			OnlyIn:   m.OnlyIn,
+		}
+		if m.OnlyIn == "A" {
+			r.SourceA = m.Path
+		} else {
+			r.SourceB = m.Path
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// metricNames returns every comparison type of the run in order of first
+// appearance, used as columns for csv and table output.
+func metricNames(records []Record) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, r := range records {
+		for _, res := range r.Results {
+			if !seen[res.Comparison] {
+				seen[res.Comparison] = true
+				names = append(names, res.Comparison)
+			}
+		}
+	}
+	return names
+}
+
+func findResult(r Record, name string) (shared.ResultData, bool) {
+	for _, res := range r.Results {
+		if res.Comparison == name {
+			return res, true
+		}
+	}
+	return shared.ResultData{}, false
+}
+
+func writeRecords(w io.Writer, s RunSummary) error {
+	records := s.Records()
+
+	switch s.Data.Format {
+	case "json":
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		return writeCSV(w, records)
+	case "table":
+		return writeTable(w, records)
+	default:
+		return fmt.Errorf("output format \"%s\" not supported", s.Data.Format)
+	}
+}
+
+func writeCSV(w io.Writer, records []Record) error {
+	names := metricNames(records)
+
+	header := []string{"source_a", "source_b", "location"}
+	for _, n := range names {
+		header = append(header, n+"_index", n+"_numfailed")
+	}
+	header = append(header, "passed", "reasons", "duration_seconds", "errors", "only_in")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		row := []string{r.SourceA, r.SourceB, r.Location}
+		for _, n := range names {
+			if res, ok := findResult(r, n); ok {
+				row = append(row, strconv.FormatFloat(res.Index, 'g', -1, 64), strconv.Itoa(res.NumFailed))
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		row = append(row, strconv.FormatBool(r.Passed), strings.Join(r.Reasons, "; "), strconv.FormatFloat(r.Duration, 'f', 3, 64), strings.Join(r.Errors, "; "), r.OnlyIn)
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTable(w io.Writer, records []Record) error {
+	names := metricNames(records)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := []string{"SOURCE A", "SOURCE B", "LOCATION"}
+	for _, n := range names {
+		header = append(header, strings.ToUpper(n))
+	}
+	header = append(header, "PASSED", "DURATION", "ONLY IN", "ERRORS")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, r := range records {
+		row := []string{r.SourceA, r.SourceB, r.Location}
+		for _, n := range names {
+			if res, ok := findResult(r, n); ok {
+				row = append(row, fmt.Sprintf("%.4f/%d", res.Index, res.NumFailed))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		row = append(row, strconv.FormatBool(r.Passed), fmt.Sprintf("%.3fs", r.Duration), r.OnlyIn, strings.Join(r.Errors, "; "))
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"ic/compare/imagecompare"
+	"ic/compare/imagecompare/utils"
+)
+
+// compareOptions maps the command line settings to the library options.
+func compareOptions(data utils.CompareData) imagecompare.Options {
+	return imagecompare.Options{
+		Comparisons: data.Comparisons,
+		MinIndex:    data.MinIndex,
+		MinIndexes:  data.MinIndexes,
+		MaxFailed:   limit(data.MaxFailed),
+		MaxRegion:   limit(data.MaxRegion),
+		Threads:     data.Threads,
+	}
+}
+
+// limit maps the -1 of the command line to a disabled check.
+func limit(n int) *int {
+	if n < 0 {
+		return nil
+	}
+	return imagecompare.Limit(n)
+}
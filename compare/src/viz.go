@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	vizHeatmap    = "heatmap"
+	vizSideBySide = "sidebyside"
+	vizFlicker    = "flicker"
+)
+
+const heatmapAlpha = 0.6
+const labelHeight = 18
+
+// Delay between the flicker frames in 100ths of a second.
+const flickerDelay = 50
+
+func getVisualizations(vizString string) ([]string, error) {
+	visualizations := []string{}
+	if len(vizString) == 0 {
+		return visualizations, nil
+	}
+
+	for _, v := range strings.Split(vizString, ",") {
+		switch v {
+		case vizHeatmap, vizSideBySide, vizFlicker:
+			visualizations = append(visualizations, v)
+		default:
+			return nil, fmt.Errorf("visualization \"%s\" not supported", v)
+		}
+	}
+
+	return visualizations, nil
+}
+
+func visualizationFiles(visualizations []string, results []shared.ResultData) []string {
+	files := []string{}
+	for _, v := range visualizations {
+		switch v {
+		case vizHeatmap, vizSideBySide:
+			for _, r := range results {
+				files = append(files, r.Comparison+"_"+v+".png")
+			}
+		case vizFlicker:
+			files = append(files, "flicker.gif")
+		}
+	}
+	return files
+}
+
+// displayable tone maps float images so they can be written as 8 or 16 bit.
+func displayable(img image.Image, exposure float64) image.Image {
+	if _, ok := img.(*shared.ImageF32); ok {
+		return shared.ToneMap(img, exposure)
+	}
+	return img
+}
+
+func exportVisualizations(set utils.CompareSet, diffs []image.Image, comparison shared.Comparison) error {
+	imgA := displayable(set.ImageA, set.Data.Exposure)
+	imgB := displayable(set.ImageB, set.Data.Exposure)
+
+	for _, v := range set.Data.Visualizations {
+		var err error
+		switch v {
+		case vizHeatmap:
+			for i, r := range comparison.Results {
+				img := heatmap(imgA, diffs[i], set.Data.Colormap)
+				err = writePNG(filepath.Join(comparison.Location, r.Comparison+"_"+v+".png"), img)
+				if err != nil {
+					break
+				}
+			}
+		case vizSideBySide:
+			for i, r := range comparison.Results {
+				img := sideBySide([]image.Image{imgA, imgB, diffs[i]}, []string{comparison.SourceA, comparison.SourceB, r.Comparison})
+				err = writePNG(filepath.Join(comparison.Location, r.Comparison+"_"+v+".png"), img)
+				if err != nil {
+					break
+				}
+			}
+		case vizFlicker:
+			err = writeFlicker(filepath.Join(comparison.Location, "flicker.gif"), imgA, imgB)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writePNG(path string, img image.Image) error {
+	return shared.CreateAtomic(path, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
+
+func heatmap(base image.Image, diff image.Image, colormap string) image.Image {
+	bounds := base.Bounds()
+	result := image.NewNRGBA(bounds)
+
+	blend := func(b float64, overlay uint8) uint8 {
+		return uint8(math.Round((b*(1-heatmapAlpha) + float64(overlay)/0xff*heatmapAlpha) * 0xff))
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v, _, _, _ := shared.FloatRGBA(diff.At(x, y))
+			c := utils.MapColor(colormap, v)
+
+			r, g, b, _ := shared.FloatRGBA(base.At(x, y))
+			result.SetNRGBA(x, y, color.NRGBA{blend(r, c.R), blend(g, c.G), blend(b, c.B), 0xff})
+		}
+	}
+
+	return result
+}
+
+func sideBySide(images []image.Image, labels []string) image.Image {
+	w, h := 0, 0
+	for _, img := range images {
+		w = max(w, img.Bounds().Dx())
+		h = max(h, img.Bounds().Dy())
+	}
+
+	result := image.NewNRGBA(image.Rect(0, 0, w*len(images), h+labelHeight))
+	draw.Draw(result, result.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	for i, img := range images {
+		r := image.Rect(i*w, labelHeight, (i+1)*w, labelHeight+h)
+		draw.Draw(result, r, img, img.Bounds().Min, draw.Src)
+
+		d := font.Drawer{
+			Dst:  result,
+			Src:  image.White,
+			Face: basicfont.Face7x13,
+			Dot:  fixed.P(i*w+4, labelHeight-5),
+		}
+		d.DrawString(labels[i])
+	}
+
+	return result
+}
+
+func writeFlicker(path string, a image.Image, b image.Image) error {
+	anim := gif.GIF{}
+	for _, img := range []image.Image{a, b} {
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.Draw(frame, frame.Rect, img, img.Bounds().Min, draw.Src)
+
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, flickerDelay)
+	}
+
+	return shared.CreateAtomic(path, func(w io.Writer) error {
+		return gif.EncodeAll(w, &anim)
+	})
+}
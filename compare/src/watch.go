@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"ic/compare/imagecompare/utils"
+	"ic/shared"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// stamp is the modification time and size of both sources of a pair, -watch
+// compares a pair again when it changes.
+type stamp struct {
+	modA, modB   time.Time
+	sizeA, sizeB int64
+}
+
+func fileStamp(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
+
+func pairStamp(s utils.CompareSet) stamp {
+	var st stamp
+	st.modA, st.sizeA = fileStamp(s.ImageAPath)
+	st.modB, st.sizeB = fileStamp(s.ImageBPath)
+	return st
+}
+
+func setKey(s utils.CompareSet) string {
+	return s.ImageAPath + "\x00" + s.ImageBPath
+}
+
+func sourceStamps(sets []utils.CompareSet) map[string]stamp {
+	stamps := map[string]stamp{}
+	for _, s := range sets {
+		stamps[setKey(s)] = pairStamp(s)
+	}
+	return stamps
+}
+
+// watch polls the sources every WatchInterval and compares the pairs whose
+// sources changed until ctx is done, printing what changed to w.
+func watch(ctx context.Context, w io.Writer, summary RunSummary) RunSummary {
+	stamps := sourceStamps(summary.Sets)
+
+	ticker := time.NewTicker(summary.Data.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return summary
+		case <-ticker.C:
+		}
+
+		next, nextStamps, err := watchOnce(ctx, summary, stamps)
+		if err != nil {
+			fmt.Fprintf(w, "watch: %v\n", err)
+			continue
+		}
+
+		printDelta(w, summary, next)
+		summary, stamps = next, nextStamps
+	}
+}
+
+// watchOnce loads the pairs again and compares the new ones and those whose
+// stamp changed, the other results are carried over from summary.
+func watchOnce(ctx context.Context, summary RunSummary, stamps map[string]stamp) (RunSummary, map[string]stamp, error) {
+	// Sources that were touched without changing are reused by hash.
+	data := summary.Data
+	data.Resume = false
+	data.Incremental = true
+
+	sets, missing, skipped, err := load(data)
+	if err != nil {
+		return summary, stamps, err
+	}
+
+	previous := map[string]int{}
+	for i, s := range summary.Sets {
+		if summary.Finished[i] {
+			previous[setKey(s)] = i
+		}
+	}
+
+	next := RunSummary{
+		Data:        summary.Data,
+		Sets:        sets,
+		Comparisons: make([]shared.Comparison, len(sets)),
+		Durations:   make([]time.Duration, len(sets)),
+		Reused:      make([]bool, len(sets)),
+		Finished:    make([]bool, len(sets)),
+		Missing:     missing,
+		Skipped:     skipped,
+	}
+	nextStamps := map[string]stamp{}
+
+	changed := []utils.CompareSet{}
+	changedIndex := []int{}
+	for i, s := range sets {
+		key := setKey(s)
+		st := pairStamp(s)
+		nextStamps[key] = st
+
+		if j, ok := previous[key]; ok && stamps[key] == st {
+			next.Comparisons[i] = summary.Comparisons[j]
+			next.Durations[i] = summary.Durations[j]
+			next.Reused[i] = summary.Reused[j]
+			next.Finished[i] = true
+			continue
+		}
+
+		changed = append(changed, s)
+		changedIndex = append(changedIndex, i)
+	}
+
+	if len(changed) == 0 && len(sets) == len(summary.Sets) {
+		return next, nextStamps, nil
+	}
+
+	compared, err := compareAll(ctx, data, changed, newProgress(progressOff, len(changed)))
+	if err != nil {
+		return summary, stamps, err
+	}
+	for k, i := range changedIndex {
+		next.Comparisons[i] = compared.Comparisons[k]
+		next.Durations[i] = compared.Durations[k]
+		next.Reused[i] = compared.Reused[k]
+		next.Finished[i] = compared.Finished[k]
+
+		// Unfinished pairs are compared again in the next iteration.
+		if !compared.Finished[k] {
+			delete(nextStamps, setKey(changed[k]))
+		}
+	}
+
+	if err := writeOutputs(next); err != nil {
+		return summary, stamps, err
+	}
+
+	return next, nextStamps, nil
+}
+
+func verdict(c shared.Comparison) string {
+	switch {
+	case len(c.Errors) > 0:
+		return "error"
+	case c.Passed:
+		return "passed"
+	default:
+		return "failed"
+	}
+}
+
+// resultChanges lists the verdict and index changes from old to c.
+func resultChanges(old shared.Comparison, c shared.Comparison) []string {
+	changes := []string{}
+	if verdict(old) != verdict(c) {
+		changes = append(changes, verdict(old)+" -> "+verdict(c))
+	}
+
+	oldIndex := map[string]float64{}
+	for _, r := range old.Results {
+		oldIndex[r.Comparison] = r.Index
+	}
+	for _, r := range c.Results {
+		v, ok := oldIndex[r.Comparison]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s %.4g", r.Comparison, r.Index))
+		} else if v != r.Index {
+			changes = append(changes, fmt.Sprintf("%s %.4g -> %.4g", r.Comparison, v, r.Index))
+		}
+	}
+
+	return changes
+}
+
+// printDelta prints the pairs that were added, removed or whose results
+// changed between two iterations, nothing when none did.
+func printDelta(w io.Writer, prev RunSummary, next RunSummary) {
+	before := map[string]shared.Comparison{}
+	for i, s := range prev.Sets {
+		if prev.Finished[i] {
+			before[setKey(s)] = prev.Comparisons[i]
+		}
+	}
+
+	lines := []string{}
+	current := map[string]bool{}
+	for i, s := range next.Sets {
+		key := setKey(s)
+		current[key] = true
+		c := next.Comparisons[i]
+
+		if !next.Finished[i] {
+			lines = append(lines, fmt.Sprintf("  ? %s: unfinished", c.Name()))
+			continue
+		}
+
+		old, ok := before[key]
+		if !ok {
+			lines = append(lines, fmt.Sprintf("  + %s: %s", c.Name(), verdict(c)))
+		} else if changes := resultChanges(old, c); len(changes) > 0 {
+			lines = append(lines, fmt.Sprintf("  ~ %s: %s", c.Name(), strings.Join(changes, ", ")))
+		}
+	}
+	for i, s := range prev.Sets {
+		if !current[setKey(s)] {
+			lines = append(lines, fmt.Sprintf("  - %s", prev.Comparisons[i].Name()))
+		}
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	failing := 0
+	for i, c := range next.Comparisons {
+		if next.Finished[i] && !c.Passed {
+			failing++
+		}
+	}
+
+	fmt.Fprintf(w, "%s %d changed, %d of %d pairs failing\n", time.Now().Format("15:04:05"), len(lines), failing, len(next.Comparisons))
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+}
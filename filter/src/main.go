@@ -8,54 +8,83 @@ import (
 )
 
 var (
-	comparison = flag.String("c", "all", "Optional: Comparison options, [pixel,contrast,quad,ssim,mse].")
+	comparison = flag.String("c", "all", "Optional: Comparison options, [pixel,contrast,quad,ssim,mse,relative].")
 	index      = flag.Float64("i", 1.0, "Optional: Index threshold.")
 	numFailed  = flag.Int("n", 0, "Optional: Num failed points.")
 	directory  = flag.String("d", "", "Optional: Path to directory to filter.")
+	junit      = flag.String("junit", "", "Optional: Path to write a JUnit XML report to, filtered comparisons are failures.")
 )
 
-func filterComparisons(comparisons []shared.Comparison) []shared.Comparison {
-	filtered := []shared.Comparison{}
+// matchReasons describes every result of c that passes the filter, an empty
+// list means c is filtered out.
+func matchReasons(c shared.Comparison) []string {
+	reasons := []string{}
+
+	// Files only on one side have no results to filter, they are always listed.
+	if len(c.OnlyIn) > 0 {
+		return append(reasons, "only in "+c.OnlyIn)
+	}
 
 	comp := shared.GetComparisons(*comparison)
 
-	for _, c := range comparisons {
-		for _, r := range c.Results {
-			compareMatch := false
-			for _, c := range comp {
-				if c == shared.ComparisonType(r.Comparison) {
-					compareMatch = true
-					break
-				}
+	for _, r := range c.Results {
+		compareMatch := false
+		for _, c := range comp {
+			if c == shared.ComparisonType(r.Comparison) {
+				compareMatch = true
+				break
 			}
+		}
 
-			if !compareMatch {
-				continue
-			}
+		if !compareMatch {
+			continue
+		}
+
+		if r.Index > *index {
+			continue
+		}
 
-			if r.Index > *index {
+		if *numFailed != 0 {
+			if r.NumFailed > *numFailed || r.NumFailed == -1 {
 				continue
 			}
+		}
 
-			if *numFailed != 0 {
-				if r.NumFailed > *numFailed || r.NumFailed == -1 {
-					continue
-				}
-			}
+		reasons = append(reasons, fmt.Sprintf("%s index %v at or below %v, %d failed points", r.Comparison, r.Index, *index, r.NumFailed))
+	}
+
+	return reasons
+}
+
+func filterComparisons(comparisons []shared.Comparison) []shared.Comparison {
+	filtered := []shared.Comparison{}
 
+	for _, c := range comparisons {
+		if len(matchReasons(c)) > 0 {
 			filtered = append(filtered, c)
-			break
 		}
 	}
 
 	return filtered
 }
 
-
 func main() {
     flag.Parse()
 
     comparisons := shared.FindMetaFiles(*directory)
+
+    if len(*junit) > 0 {
+        cases := []shared.TestCase{}
+        for _, c := range comparisons {
+            cases = append(cases, shared.TestCase{Comparison: c, Failures: matchReasons(c)})
+        }
+
+        if err := shared.WriteJUnit(*junit, "filter", cases); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+    }
+
     comparisons = filterComparisons(comparisons)
 
 	for _, c := range comparisons {
@@ -0,0 +1,10 @@
+module ic/report
+
+go 1.21.0
+
+replace ic/shared => ../shared
+
+require (
+	golang.org/x/image v0.23.0
+	ic/shared v0.0.0-00010101000000-000000000000
+)
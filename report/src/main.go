@@ -0,0 +1,307 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"html/template"
+	"ic/shared"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"index4": func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) },
+}).ParseFS(templateFiles, "templates/*.html"))
+
+const thumbnailWidth = 160
+
+type ReportData struct {
+	Directory   string
+	Comparisons []string
+	Rows        []Row
+}
+
+type Row struct {
+	Name     string
+	Page     string
+	Thumb    string
+	Metrics  []Metric
+	Images   []ReportImage
+	ImageA   ReportImage
+	ImageB   ReportImage
+	SourceA  string
+	SourceB  string
+	Location string
+	Errors   []string
+	OnlyIn   string
+}
+
+type Metric struct {
+	Comparison string
+	Index      float64
+	NumFailed  int
+	Present    bool
+}
+
+type ReportImage struct {
+	Label string
+	Path  string
+}
+
+type ReportArgs struct {
+	Directory string
+	Output    string
+}
+
+func validateArgs(args []string) (ReportArgs, error) {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+
+	d := fs.String("d", "", "Path to directory with comparison results.")
+	o := fs.String("o", "report", "Optional: output directory.")
+
+	if err := fs.Parse(args); err != nil {
+		return ReportArgs{}, err
+	}
+
+	info, err := os.Stat(*d)
+	if err != nil || !info.IsDir() {
+		return ReportArgs{}, fmt.Errorf("no results directory provided")
+	}
+
+	return ReportArgs{Directory: *d, Output: *o}, nil
+}
+
+// comparisonNames returns every comparison type found in the tree, in order
+// of first appearance, so the table has one column pair per type.
+func comparisonNames(comparisons []shared.Comparison) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, c := range comparisons {
+		for _, r := range c.Results {
+			if !seen[r.Comparison] {
+				seen[r.Comparison] = true
+				names = append(names, r.Comparison)
+			}
+		}
+	}
+	return names
+}
+
+// convertImage writes src as a PNG browsers can display, animated GIFs are
+// copied as they are.
+func convertImage(src string, dst string) error {
+	if strings.ToLower(filepath.Ext(src)) == ".gif" {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0644)
+	}
+
+	img, err := shared.LoadImage(src)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := img.(*shared.ImageF32); ok {
+		img = shared.ToneMap(img, 0.0)
+	}
+
+	return writePNG(dst, img)
+}
+
+func writeThumbnail(src string, dst string) error {
+	img, err := shared.LoadImage(src)
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return fmt.Errorf("empty image %s", src)
+	}
+
+	h := max(1, bounds.Dy()*thumbnailWidth/bounds.Dx())
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbnailWidth, h))
+	draw.ApproxBiLinear.Scale(thumb, thumb.Bounds(), img, bounds, draw.Src, nil)
+
+	return writePNG(dst, thumb)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+func writeTemplate(path string, name string, data interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return templates.ExecuteTemplate(f, name, data)
+}
+
+func outputName(file string) string {
+	if strings.ToLower(filepath.Ext(file)) == ".gif" {
+		return file
+	}
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".png"
+}
+
+func buildRow(args ReportArgs, c shared.Comparison, id int, names []string) (Row, error) {
+	name, err := filepath.Rel(args.Directory, c.Dir)
+	if err != nil || name == "." {
+		name = filepath.Base(c.Dir)
+	}
+
+	imageDir := filepath.Join("images", strconv.Itoa(id))
+	if err := os.MkdirAll(filepath.Join(args.Output, imageDir), os.ModePerm); err != nil {
+		return Row{}, err
+	}
+
+	row := Row{
+		Name:     filepath.ToSlash(name),
+		Page:     "pages/" + strconv.Itoa(id) + ".html",
+		Thumb:    "thumbs/" + strconv.Itoa(id) + ".png",
+		SourceA:  c.SourceA,
+		SourceB:  c.SourceB,
+		Location: c.Location,
+		Errors:   c.Errors,
+		OnlyIn:   c.OnlyIn,
+	}
+
+	for _, n := range names {
+		m := Metric{Comparison: n}
+		for _, r := range c.Results {
+			if r.Comparison == n {
+				m = Metric{Comparison: n, Index: r.Index, NumFailed: r.NumFailed, Present: true}
+				break
+			}
+		}
+		row.Metrics = append(row.Metrics, m)
+	}
+
+	// Pairs that failed to load have no images, only their errors.
+	if len(c.Results) == 0 && len(c.Errors) > 0 {
+		row.Thumb = ""
+		return row, nil
+	}
+
+	convert := func(file string, label string, prefix string) (ReportImage, error) {
+		dst := filepath.Join(imageDir, prefix+outputName(file))
+		if err := convertImage(filepath.Join(c.Dir, file), filepath.Join(args.Output, dst)); err != nil {
+			return ReportImage{}, err
+		}
+		return ReportImage{Label: label, Path: "../" + filepath.ToSlash(dst)}, nil
+	}
+
+	// Files only on one side have a single source, directories none.
+	if len(c.OnlyIn) > 0 {
+		row.Thumb = ""
+		source, prefix := c.SourceA, "a_"
+		if c.OnlyIn == "B" {
+			source, prefix = c.SourceB, "b_"
+		}
+		if info, err := os.Stat(filepath.Join(c.Dir, source)); err != nil || info.IsDir() {
+			return row, nil
+		}
+
+		img, err := convert(source, c.OnlyIn+": "+source, prefix)
+		if err != nil {
+			return Row{}, err
+		}
+		row.Images = append(row.Images, img)
+		return row, nil
+	}
+
+	// Prefix the sources so they can't collide with each other or a diff.
+	if row.ImageA, err = convert(c.SourceA, "A: "+c.SourceA, "a_"); err != nil {
+		return Row{}, err
+	}
+	if row.ImageB, err = convert(c.SourceB, "B: "+c.SourceB, "b_"); err != nil {
+		return Row{}, err
+	}
+
+	for _, r := range c.Results {
+		img, err := convert(r.ImageName(), r.Comparison, "")
+		if err != nil {
+			return Row{}, err
+		}
+		row.Images = append(row.Images, img)
+	}
+	for _, v := range c.Visualizations {
+		img, err := convert(v, v, "")
+		if err != nil {
+			return Row{}, err
+		}
+		row.Images = append(row.Images, img)
+	}
+
+	if err := writeThumbnail(filepath.Join(c.Dir, c.SourceA), filepath.Join(args.Output, "thumbs", strconv.Itoa(id)+".png")); err != nil {
+		return Row{}, err
+	}
+
+	return row, nil
+}
+
+func run(args []string) error {
+	reportArgs, err := validateArgs(args)
+	if err != nil {
+		return err
+	}
+
+	comparisons := shared.FindMetaFiles(reportArgs.Directory)
+	if len(comparisons) == 0 {
+		return fmt.Errorf("no comparison data found, make sure directory contains a meta.json file")
+	}
+
+	sort.Slice(comparisons, func(i, j int) bool {
+		return comparisons[i].Dir < comparisons[j].Dir
+	})
+
+	for _, dir := range []string{"pages", "thumbs", "images"} {
+		if err := os.MkdirAll(filepath.Join(reportArgs.Output, dir), os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	report := ReportData{Directory: reportArgs.Directory, Comparisons: comparisonNames(comparisons)}
+	for i, c := range comparisons {
+		row, err := buildRow(reportArgs, c, i, report.Comparisons)
+		if err != nil {
+			return err
+		}
+		report.Rows = append(report.Rows, row)
+
+		if err := writeTemplate(filepath.Join(reportArgs.Output, row.Page), "detail.html", row); err != nil {
+			return err
+		}
+	}
+
+	return writeTemplate(filepath.Join(reportArgs.Output, "index.html"), "index.html", report)
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"ic/shared"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeResult(t *testing.T, dir string, comparison shared.Comparison) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		comparison.SourceA: "../../testAssets/white.png",
+		comparison.SourceB: "../../testAssets/black.png",
+		"pixel.png":        "../../testAssets/black.png",
+	}
+	for dst, src := range files {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, dst), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, _ := json.Marshal(comparison)
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	results := t.TempDir()
+	out := t.TempDir()
+
+	writeResult(t, filepath.Join(results, "icons", "white"), shared.Comparison{
+		SourceA: "white_A.png",
+		SourceB: "white_B.png",
+		Results: []shared.ResultData{{Comparison: "pixel", Index: 0.0, NumFailed: 576, Image: "pixel.png"}},
+	})
+
+	if err := run([]string{"-d", results, "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(index), "icons/white") {
+		t.Error("Report test failed, index does not list the comparison")
+	}
+
+	if strings.Contains(string(index), "http://") || strings.Contains(string(index), "https://") {
+		t.Error("Report test failed, index references external assets")
+	}
+
+	for _, file := range []string{"pages/0.html", "thumbs/0.png", "images/0/a_white_A.png", "images/0/b_white_B.png", "images/0/pixel.png"} {
+		if _, err := os.Stat(filepath.Join(out, file)); err != nil {
+			t.Errorf("Report test failed, %s missing", file)
+		}
+	}
+}
+
+func TestReportErrors(t *testing.T) {
+	results := t.TempDir()
+	out := t.TempDir()
+
+	dir := filepath.Join(results, "broken")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(shared.Comparison{SourceA: "broken_A.png", SourceB: "broken_B.png", Errors: []string{"unexpected EOF"}})
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"-d", results, "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := os.ReadFile(filepath.Join(out, "pages", "0.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "unexpected EOF") {
+		t.Error("Report error test failed, detail page does not show the error")
+	}
+}
+
+func TestReportOnlyIn(t *testing.T) {
+	results := t.TempDir()
+	out := t.TempDir()
+
+	dir := filepath.Join(results, "new")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile("../../testAssets/white.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.png"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(shared.Comparison{SourceB: "new.png", OnlyIn: "B", Results: []shared.ResultData{}})
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"-d", results, "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "only in B") {
+		t.Error("Report only in test failed, index does not mark the file")
+	}
+	if _, err := os.Stat(filepath.Join(out, "images", "0", "b_new.png")); err != nil {
+		t.Error("Report only in test failed, source B missing")
+	}
+}
@@ -0,0 +1,14 @@
+module ic/serve
+
+go 1.21.0
+
+replace ic/shared => ../shared
+
+replace ic/compare => ../compare
+
+require (
+	ic/compare v0.0.0-00010101000000-000000000000
+	ic/shared v0.0.0-00010101000000-000000000000
+)
+
+require golang.org/x/image v0.23.0 // indirect
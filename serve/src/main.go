@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"ic/compare/imagecompare"
+	"ic/shared"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ServeArgs struct {
+	Addr      string
+	Directory string
+	Root      string
+	MaxUpload int64
+	MaxPixels int
+
+	// MaxConcurrent is the number of compare requests handled at once,
+	// others wait for a free slot.
+	MaxConcurrent int
+}
+
+// Result is a stored comparison with the URLs of its files.
+type Result struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	shared.Comparison
+	Images map[string]string `json:"images"`
+}
+
+// source is one side of a compare request.
+type source struct {
+	name string
+	path string
+	data []byte
+}
+
+type server struct {
+	args  ServeArgs
+	files http.Handler
+	slots chan struct{}
+}
+
+// requestError carries the status code a request error is answered with.
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e requestError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return requestError{http.StatusBadRequest, fmt.Errorf(format, a...)}
+}
+
+func tooLarge(format string, a ...interface{}) error {
+	return requestError{http.StatusRequestEntityTooLarge, fmt.Errorf(format, a...)}
+}
+
+func validateArgs(args []string) (ServeArgs, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+
+	addr := fs.String("addr", "localhost:8080", "Optional: Address to listen on.")
+	d := fs.String("d", "", "Directory comparison results are stored in and listed from.")
+	root := fs.String("root", "", "Optional: Directory requests can reference sources in by relative path, disabled when empty.")
+	maxUpload := fs.Int64("max-upload", 64<<20, "Optional: Maximum size in bytes of a compare request or source file.")
+	maxPixels := fs.Int("max-pixels", 64<<20, "Optional: Maximum width x height of a source image.")
+	maxConcurrent := fs.Int("max-concurrent", runtime.NumCPU(), "Optional: Maximum number of compare requests handled at once, others wait.")
+
+	if err := fs.Parse(args); err != nil {
+		return ServeArgs{}, err
+	}
+
+	if len(*d) == 0 {
+		return ServeArgs{}, fmt.Errorf("no results directory provided")
+	}
+	if err := os.MkdirAll(*d, os.ModePerm); err != nil {
+		return ServeArgs{}, err
+	}
+
+	if len(*root) > 0 {
+		info, err := os.Stat(*root)
+		if err != nil || !info.IsDir() {
+			return ServeArgs{}, fmt.Errorf("source root \"%s\" is not a directory", *root)
+		}
+	}
+
+	if *maxUpload <= 0 || *maxPixels <= 0 {
+		return ServeArgs{}, fmt.Errorf("size limits must be positive")
+	}
+	if *maxConcurrent <= 0 {
+		return ServeArgs{}, fmt.Errorf("max concurrent requests must be positive")
+	}
+
+	return ServeArgs{Addr: *addr, Directory: *d, Root: *root, MaxUpload: *maxUpload, MaxPixels: *maxPixels, MaxConcurrent: *maxConcurrent}, nil
+}
+
+func newServer(args ServeArgs) http.Handler {
+	s := &server{
+		args:  args,
+		files: http.StripPrefix("/results/", http.FileServer(http.Dir(args.Directory))),
+		slots: make(chan struct{}, max(1, args.MaxConcurrent)),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/compare", s.handleCompare)
+	mux.HandleFunc("/results", s.handleList)
+	mux.HandleFunc("/results/", s.handleResult)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	var reqErr requestError
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &reqErr) {
+		status = reqErr.status
+	} else if errors.As(err, &maxErr) {
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, requestError{http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)})
+	return false
+}
+
+// resultURL is the URL of id or a file in it, ids are slash separated paths
+// relative to the results directory.
+func resultURL(id string, file ...string) string {
+	u := url.URL{Path: path.Join(append([]string{"/results", id}, file...)...)}
+	return u.String()
+}
+
+func (s *server) result(c shared.Comparison) Result {
+	id, err := filepath.Rel(s.args.Directory, c.Dir)
+	if err != nil {
+		id = filepath.Base(c.Dir)
+	}
+	id = filepath.ToSlash(id)
+
+	r := Result{ID: id, URL: resultURL(id), Comparison: c, Images: map[string]string{}}
+	for _, res := range c.Results {
+		r.Images[res.Comparison] = resultURL(id, res.ImageName())
+	}
+	return r
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	comparisons, err := shared.ReadMetaFiles(s.args.Directory)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	results := []Result{}
+	for _, c := range comparisons {
+		results = append(results, s.result(c))
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleResult answers a result directory with its meta.json and any other
+// path with the file.
+func (s *server) handleResult(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	rel := filepath.FromSlash(strings.Trim(strings.TrimPrefix(r.URL.Path, "/results/"), "/"))
+	if !filepath.IsLocal(rel) {
+		writeError(w, requestError{http.StatusNotFound, fmt.Errorf("result not found")})
+		return
+	}
+
+	p := filepath.Join(s.args.Directory, rel)
+	info, err := os.Stat(p)
+	if err != nil {
+		writeError(w, requestError{http.StatusNotFound, fmt.Errorf("result not found")})
+		return
+	}
+
+	if !info.IsDir() {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	c, err := shared.ReadMetaFile(filepath.Join(p, "meta.json"))
+	if err != nil {
+		writeError(w, requestError{http.StatusNotFound, fmt.Errorf("result not found")})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.result(c))
+}
+
+func (s *server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// The body is only read once a slot is free, so waiting requests don't
+	// hold their uploads in memory.
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-r.Context().Done():
+		writeError(w, requestError{http.StatusServiceUnavailable, fmt.Errorf("server busy")})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.args.MaxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		writeError(w, err)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	c, err := s.compare(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.result(c))
+}
+
+func requestOptions(r *http.Request) (imagecompare.Options, shared.LoadOptions, error) {
+	opts := imagecompare.DefaultOptions()
+
+	c := r.FormValue("c")
+	if len(c) == 0 {
+		c = "all"
+	}
+	opts.Comparisons = shared.GetComparisons(c)
+	if len(opts.Comparisons) == 0 {
+		return opts, shared.LoadOptions{}, badRequest("comparison options \"%s\" not supported", c)
+	}
+
+	var err error
+	opts.MinIndex, opts.MinIndexes, err = imagecompare.ParseMinIndex(r.FormValue("min_index"))
+	if err != nil {
+		return opts, shared.LoadOptions{}, badRequest("%v", err)
+	}
+
+	// A negative limit disables the check like on the command line.
+	for name, v := range map[string]**int{"max_failed": &opts.MaxFailed, "max_region": &opts.MaxRegion} {
+		if s := r.FormValue(name); len(s) > 0 {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return opts, shared.LoadOptions{}, badRequest("invalid %s \"%s\"", name, s)
+			}
+			if n >= 0 {
+				*v = imagecompare.Limit(n)
+			}
+		}
+	}
+
+	loadOpts := shared.LoadOptions{IgnoreOrientation: r.FormValue("no_orientation") == "true"}
+
+	return opts, loadOpts, nil
+}
+
+// readSource reads side "a" or "b" of a request, either an uploaded file
+// or a "<side>_path" relative to the source root.
+func (s *server) readSource(r *http.Request, side string) (source, error) {
+	if r.MultipartForm != nil && len(r.MultipartForm.File[side]) > 0 {
+		header := r.MultipartForm.File[side][0]
+
+		f, err := header.Open()
+		if err != nil {
+			return source{}, err
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return source{}, err
+		}
+
+		return source{name: filepath.Base(header.Filename), data: data}, nil
+	}
+
+	p := r.FormValue(side + "_path")
+	if len(p) == 0 {
+		return source{}, badRequest("no source %s provided", strings.ToUpper(side))
+	}
+	if len(s.args.Root) == 0 {
+		return source{}, badRequest("sources by path are disabled")
+	}
+
+	rel := filepath.FromSlash(p)
+	if !filepath.IsLocal(rel) {
+		return source{}, badRequest("source %s \"%s\" is outside the source root", strings.ToUpper(side), p)
+	}
+
+	// Symlinks inside the root may point anywhere, the resolved path has to
+	// stay inside the resolved root.
+	root, err := filepath.EvalSymlinks(s.args.Root)
+	if err != nil {
+		return source{}, err
+	}
+	full, err := filepath.EvalSymlinks(filepath.Join(root, rel))
+	if err != nil {
+		return source{}, badRequest("source %s \"%s\" not found", strings.ToUpper(side), p)
+	}
+	if rel, err := filepath.Rel(root, full); err != nil || !filepath.IsLocal(rel) {
+		return source{}, badRequest("source %s \"%s\" is outside the source root", strings.ToUpper(side), p)
+	}
+
+	info, err := os.Stat(full)
+	if err != nil || info.IsDir() {
+		return source{}, badRequest("source %s \"%s\" not found", strings.ToUpper(side), p)
+	}
+	if info.Size() > s.args.MaxUpload {
+		return source{}, tooLarge("source %s \"%s\" is larger than %d bytes", strings.ToUpper(side), p, s.args.MaxUpload)
+	}
+
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return source{}, err
+	}
+
+	abs, err := filepath.Abs(full)
+	if err != nil {
+		return source{}, err
+	}
+
+	return source{name: filepath.Base(full), path: abs, data: data}, nil
+}
+
+func (s *server) decode(src source, opts shared.LoadOptions) (image.Image, shared.ImageInfo, error) {
+	cfg, _, err := shared.DecodeImageInfo(src.data, opts)
+	if err != nil {
+		return nil, shared.ImageInfo{}, badRequest("%s: %v", src.name, err)
+	}
+	if cfg.Width*cfg.Height > s.args.MaxPixels {
+		return nil, shared.ImageInfo{}, tooLarge("%s: %d x %d is larger than %d pixels", src.name, cfg.Width, cfg.Height, s.args.MaxPixels)
+	}
+
+	img, info, err := shared.DecodeImage(src.data, opts)
+	if err != nil {
+		return nil, shared.ImageInfo{}, badRequest("%s: %v", src.name, err)
+	}
+
+	return img, info, nil
+}
+
+func (s *server) compare(r *http.Request) (shared.Comparison, error) {
+	opts, loadOpts, err := requestOptions(r)
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+
+	a, err := s.readSource(r, "a")
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+	b, err := s.readSource(r, "b")
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+
+	imgA, infoA, err := s.decode(a, loadOpts)
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+	imgB, infoB, err := s.decode(b, loadOpts)
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+
+	res, err := imagecompare.Compare(r.Context(), imgA, imgB, opts)
+	if errors.Is(err, imagecompare.ErrSizeMismatch) {
+		return shared.Comparison{}, badRequest("%v", err)
+	}
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+
+	dir, err := os.MkdirTemp(s.args.Directory, "compare-")
+	if err != nil {
+		return shared.Comparison{}, err
+	}
+
+	for i := range res.Results {
+		res.Results[i].Image = res.Results[i].Comparison + ".png"
+	}
+
+	// Sources are stored under fixed names, upload names could collide with
+	// each other or the outputs.
+	a.name = "A" + filepath.Ext(a.name)
+	b.name = "B" + filepath.Ext(b.name)
+
+	c := shared.NewComparison("serve")
+	c.Location = dir
+	c.SourceA = a.name
+	c.SourceB = b.name
+	c.SourceAPath = a.path
+	c.SourceBPath = b.path
+	c.SourceAHash = shared.HashBytes(a.data)
+	c.SourceBHash = shared.HashBytes(b.data)
+	c.SourceAInfo = infoA
+	c.SourceBInfo = infoB
+	c.Results = res.Results
+	c.Passed = res.Passed
+	c.Reasons = res.Reasons
+	c.Errors = res.Errors
+	c.Dir = dir
+
+	if err := store(c, a, b, res.Diffs); err != nil {
+		os.RemoveAll(dir)
+		return shared.Comparison{}, err
+	}
+
+	return c, nil
+}
+
+// store writes the sources, diff images and meta.json like compare -o does,
+// meta.json last.
+func store(c shared.Comparison, a source, b source, diffs []image.Image) error {
+	for _, src := range []source{a, b} {
+		if err := shared.WriteFileAtomic(filepath.Join(c.Dir, src.name), src.data); err != nil {
+			return err
+		}
+	}
+
+	for i, res := range c.Results {
+		err := shared.CreateAtomic(filepath.Join(c.Dir, res.Image), func(w io.Writer) error {
+			return shared.EncodeImage(w, diffs[i], "png")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return shared.WriteFileAtomic(filepath.Join(c.Dir, "meta.json"), data)
+}
+
+func main() {
+	serveArgs, err := validateArgs(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              serveArgs.Addr,
+		Handler:           newServer(serveArgs),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving %s on http://%s", serveArgs.Directory, serveArgs.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
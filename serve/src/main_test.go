@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"ic/shared"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, args ServeArgs) *httptest.Server {
+	if len(args.Directory) == 0 {
+		args.Directory = t.TempDir()
+	}
+	if args.MaxUpload == 0 {
+		args.MaxUpload = 1 << 20
+	}
+	if args.MaxPixels == 0 {
+		args.MaxPixels = 1 << 20
+	}
+
+	srv := httptest.NewServer(newServer(args))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func upload(t *testing.T, srv *httptest.Server, a string, b string, fields map[string]string) *http.Response {
+	return uploadAs(t, srv, a, b, filepath.Base(a), filepath.Base(b), fields)
+}
+
+// uploadAs uploads a and b with the file names nameA and nameB.
+func uploadAs(t *testing.T, srv *httptest.Server, a string, b string, nameA string, nameB string, fields map[string]string) *http.Response {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for field, file := range map[string][2]string{"a": {a, nameA}, "b": {b, nameB}} {
+		data, err := os.ReadFile(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw, err := mw.CreateFormFile(field, file[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	resp, err := http.Post(srv.URL+"/compare", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareUpload(t *testing.T) {
+	srv := newTestServer(t, ServeArgs{})
+
+	resp := upload(t, srv, "../../testAssets/white.png", "../../testAssets/black.png", map[string]string{"c": "pixel", "max_failed": "0"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("compare returned %v", resp.Status)
+	}
+
+	var r Result
+	decode(t, resp, &r)
+
+	if r.Passed || len(r.Results) != 1 || r.Results[0].Index != 0.0 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+
+	img, err := http.Get(srv.URL + r.Images["pixel"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Body.Close()
+	if img.StatusCode != http.StatusOK || img.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("diff image returned %v %v", img.Status, img.Header.Get("Content-Type"))
+	}
+
+	list, err := http.Get(srv.URL + "/results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Body.Close()
+
+	var results []Result
+	decode(t, list, &results)
+	if len(results) != 1 || results[0].ID != r.ID {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	meta, err := http.Get(srv.URL + r.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meta.Body.Close()
+
+	var stored Result
+	decode(t, meta, &stored)
+	if stored.SourceA != "A.png" || stored.SourceBHash != r.SourceBHash {
+		t.Errorf("unexpected stored result %+v", stored)
+	}
+}
+
+func TestUploadNames(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t, ServeArgs{Directory: dir})
+
+	resp := uploadAs(t, srv, "../../testAssets/white.png", "../../testAssets/black.png", "meta.json", "pixel.png", map[string]string{"c": "pixel"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("compare returned %v", resp.Status)
+	}
+
+	var r Result
+	decode(t, resp, &r)
+	if r.SourceA != "A.json" || r.SourceB != "B.png" {
+		t.Errorf("sources stored as %s and %s, expected A.json and B.png", r.SourceA, r.SourceB)
+	}
+
+	if _, err := shared.ReadMetaFile(filepath.Join(dir, r.ID, "meta.json")); err != nil {
+		t.Errorf("meta.json was replaced by source A: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, r.ID, "A.json")); err != nil {
+		t.Errorf("source A was not stored: %v", err)
+	}
+}
+
+func TestComparePaths(t *testing.T) {
+	srv := newTestServer(t, ServeArgs{Root: "../../testAssets"})
+
+	resp, err := http.PostForm(srv.URL+"/compare", url.Values{"a_path": {"quadA.png"}, "b_path": {"quadB.png"}, "c": {"pixel"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("compare returned %v", resp.Status)
+	}
+
+	var r Result
+	decode(t, resp, &r)
+	if !filepath.IsAbs(r.SourceAPath) || r.Results[0].Index == 1.0 {
+		t.Errorf("unexpected result %+v", r)
+	}
+
+	for _, p := range []string{"../go.mod", "/etc/passwd"} {
+		resp, err := http.PostForm(srv.URL+"/compare", url.Values{"a_path": {p}, "b_path": {"quadB.png"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("path %s returned %v, expected 400", p, resp.Status)
+		}
+	}
+}
+
+func TestComparePathsSymlink(t *testing.T) {
+	root := t.TempDir()
+	outside, err := filepath.Abs("../../testAssets/quadA.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link.png")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	srv := newTestServer(t, ServeArgs{Root: root})
+
+	resp, err := http.PostForm(srv.URL+"/compare", url.Values{"a_path": {"link.png"}, "b_path": {"link.png"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("symlink out of the root returned %v, expected 400", resp.Status)
+	}
+}
+
+func TestComparePathsDisabled(t *testing.T) {
+	srv := newTestServer(t, ServeArgs{})
+
+	resp, err := http.PostForm(srv.URL+"/compare", url.Values{"a_path": {"quadA.png"}, "b_path": {"quadB.png"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("compare returned %v, expected 400", resp.Status)
+	}
+}
+
+func TestCompareSizes(t *testing.T) {
+	srv := newTestServer(t, ServeArgs{})
+
+	resp := upload(t, srv, "../../testAssets/white.png", "../../testAssets/orientA.png", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("compare returned %v, expected 400", resp.Status)
+	}
+}
+
+func TestCompareBusy(t *testing.T) {
+	s := &server{args: ServeArgs{Directory: t.TempDir(), MaxUpload: 1 << 20, MaxPixels: 1 << 20}, slots: make(chan struct{}, 1)}
+	s.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/compare", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	s.handleCompare(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("compare without a free slot returned %d, expected 503", rec.Code)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	srv := newTestServer(t, ServeArgs{MaxUpload: 256})
+
+	resp := upload(t, srv, "../../testAssets/screenA.png", "../../testAssets/screenB.png", nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("compare returned %v, expected 413", resp.Status)
+	}
+
+	srv = newTestServer(t, ServeArgs{MaxPixels: 16})
+
+	resp = upload(t, srv, "../../testAssets/quadA.png", "../../testAssets/quadB.png", nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("compare returned %v, expected 413", resp.Status)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var e map[string]string
+	if err := json.Unmarshal(body, &e); err != nil || len(e["error"]) == 0 {
+		t.Errorf("expected a JSON error, got %s", body)
+	}
+}
+
+func TestResultNotFound(t *testing.T) {
+	srv := newTestServer(t, ServeArgs{})
+
+	for _, p := range []string{"/results/missing", "/results/../main.go"} {
+		resp, err := http.Get(srv.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s returned %v, expected 404", p, resp.Status)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /compare returned %v, expected 405", resp.Status)
+	}
+}
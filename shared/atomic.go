@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CreateAtomic writes path through a temporary file in the same directory
+// that is renamed over it once complete, so an interrupted run never leaves
+// a partial file behind. An existing file keeps its mode, new files are
+// created 0644.
+func CreateAtomic(path string, write func(w io.Writer) error) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+
+	return err
+}
+
+func WriteFileAtomic(path string, data []byte) error {
+	return CreateAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
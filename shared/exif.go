@@ -0,0 +1,148 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+const orientationTag = 0x0112
+
+// readOrientation returns the EXIF orientation (1-8) of a JPEG or TIFF file,
+// or 0 when the file carries no orientation.
+func readOrientation(data []byte, format string) int {
+	switch format {
+	case "jpeg":
+		return jpegOrientation(data)
+	case "tiff":
+		return tiffOrientation(data)
+	default:
+		return 0
+	}
+}
+
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0
+	}
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0
+		}
+		marker := data[i+1]
+		// Start of scan, no metadata segments follow.
+		if marker == 0xDA {
+			return 0
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 0
+}
+
+func tiffOrientation(data []byte) int {
+	if len(data) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	if order.Uint16(data[2:]) != 42 {
+		return 0
+	}
+
+	ifd := int(order.Uint32(data[4:]))
+	if ifd < 8 || ifd+2 > len(data) {
+		return 0
+	}
+
+	numEntries := int(order.Uint16(data[ifd:]))
+	for e := 0; e < numEntries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(data) {
+			return 0
+		}
+
+		if order.Uint16(data[entry:]) == orientationTag {
+			o := int(order.Uint16(data[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+
+	return 0
+}
+
+// applyOrientation transforms img so that it displays upright according to
+// the EXIF orientation o.
+func applyOrientation(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5-8 swap width and height.
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	var dst draw.Image
+	if BitDepth(img) > 8 {
+		dst = image.NewNRGBA64(image.Rect(0, 0, dw, dh))
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	}
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,107 @@
+package shared
+
+import (
+	"image"
+	"image/color"
+)
+
+// ColorF32 is a non-alpha-premultiplied float color. Components are not
+// clamped, values above 1.0 are kept for HDR sources.
+type ColorF32 struct {
+	R, G, B, A float32
+}
+
+func (c ColorF32) RGBA() (r, g, b, a uint32) {
+	a = clampUnit(c.A)
+	r = clampUnit(c.R) * a / 0xffff
+	g = clampUnit(c.G) * a / 0xffff
+	b = clampUnit(c.B) * a / 0xffff
+	return
+}
+
+func clampUnit(v float32) uint32 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 0xffff
+	}
+	return uint32(v*0xffff + 0.5)
+}
+
+var ColorF32Model color.Model = color.ModelFunc(colorF32Model)
+
+func colorF32Model(c color.Color) color.Color {
+	if _, ok := c.(ColorF32); ok {
+		return c
+	}
+
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return ColorF32{}
+	}
+
+	fa := float32(a)
+	return ColorF32{float32(r) / fa, float32(g) / fa, float32(b) / fa, fa / 0xffff}
+}
+
+// FloatRGBA returns the alpha-premultiplied components of c in [0, 1], or
+// beyond 1.0 for unclamped ColorF32 values.
+func FloatRGBA(c color.Color) (r, g, b, a float64) {
+	if f, ok := c.(ColorF32); ok {
+		a = float64(f.A)
+		return float64(f.R) * a, float64(f.G) * a, float64(f.B) * a, a
+	}
+
+	ir, ig, ib, ia := c.RGBA()
+	return float64(ir) / 0xffff, float64(ig) / 0xffff, float64(ib) / 0xffff, float64(ia) / 0xffff
+}
+
+// ImageF32 is an in-memory image of ColorF32 values, 4 floats per pixel.
+type ImageF32 struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+func NewImageF32(r image.Rectangle) *ImageF32 {
+	return &ImageF32{
+		Pix:    make([]float32, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *ImageF32) ColorModel() color.Model { return ColorF32Model }
+
+func (p *ImageF32) Bounds() image.Rectangle { return p.Rect }
+
+func (p *ImageF32) At(x, y int) color.Color {
+	return p.F32At(x, y)
+}
+
+func (p *ImageF32) F32At(x, y int) ColorF32 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return ColorF32{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	return ColorF32{s[0], s[1], s[2], s[3]}
+}
+
+func (p *ImageF32) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *ImageF32) Set(x, y int, c color.Color) {
+	p.SetF32(x, y, ColorF32Model.Convert(c).(ColorF32))
+}
+
+func (p *ImageF32) SetF32(x, y int, c ColorF32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = c.R, c.G, c.B, c.A
+}
@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+type ImageInfo struct {
+	Format      string `json:"format"`
+	BitDepth    int    `json:"bit_depth"`
+	Orientation int    `json:"orientation,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+// IsImageFile sniffs the file header against the registered decoders, the
+// file extension is not taken into account.
+func IsImageFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	_, _, err = image.DecodeConfig(f)
+	return err == nil
+}
+
+func BitDepth(img image.Image) int {
+	switch img.(type) {
+	case *ImageF32:
+		return 32
+	case *image.Gray16, *image.Alpha16, *image.RGBA64, *image.NRGBA64:
+		return 16
+	default:
+		return 8
+	}
+}
+
+func modelBitDepth(m color.Model) int {
+	switch m {
+	case ColorF32Model:
+		return 32
+	case color.Gray16Model, color.Alpha16Model, color.RGBA64Model, color.NRGBA64Model:
+		return 16
+	default:
+		return 8
+	}
+}
+
+var EncodeFormats = []string{"png", "pgm", "ppm", "pam", "pfm"}
+
+func EncodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "png":
+		return png.Encode(w, img)
+	case "pgm":
+		return EncodePGM(w, img)
+	case "ppm":
+		return EncodePPM(w, img)
+	case "pam":
+		return EncodePAM(w, img)
+	case "pfm":
+		return EncodePFM(w, img)
+	default:
+		return fmt.Errorf("unsupported output format \"%s\"", format)
+	}
+}
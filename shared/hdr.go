@@ -0,0 +1,235 @@
+package shared
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+func init() {
+	image.RegisterFormat("hdr", "#?RADIANCE", decodeHDR, decodeHDRConfig)
+	image.RegisterFormat("hdr", "#?RGBE", decodeHDR, decodeHDRConfig)
+}
+
+type hdrHeader struct {
+	width   int
+	height  int
+	flipped bool
+}
+
+func readHDRHeader(r *bufio.Reader) (hdrHeader, error) {
+	h := hdrHeader{}
+	format := ""
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return h, fmt.Errorf("hdr: unterminated header: %v", err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") {
+			format = strings.TrimPrefix(line, "FORMAT=")
+		}
+	}
+
+	if format != "" && format != "32-bit_rle_rgbe" {
+		return h, fmt.Errorf("hdr: unsupported format %q", format)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return h, fmt.Errorf("hdr: missing resolution: %v", err)
+	}
+
+	var yAxis, xAxis string
+	if _, err := fmt.Sscanf(line, "%s %d %s %d", &yAxis, &h.height, &xAxis, &h.width); err != nil {
+		return h, fmt.Errorf("hdr: invalid resolution %q", strings.TrimSpace(line))
+	}
+	if xAxis != "+X" || (yAxis != "-Y" && yAxis != "+Y") {
+		return h, fmt.Errorf("hdr: unsupported orientation %q", strings.TrimSpace(line))
+	}
+	if !validDimensions(h.width, h.height) {
+		return h, fmt.Errorf("hdr: invalid dimensions %d x %d", h.width, h.height)
+	}
+
+	// +Y stores the bottom scanline first.
+	h.flipped = yAxis == "+Y"
+
+	return h, nil
+}
+
+func decodeHDRConfig(r io.Reader) (image.Config, error) {
+	h, err := readHDRHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{ColorModel: ColorF32Model, Width: h.width, Height: h.height}, nil
+}
+
+func decodeHDR(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	h, err := readHDRHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pixels are appended per scanline, a truncated file fails before the
+	// full image is allocated.
+	stride := 4 * h.width
+	pix := make([]float32, 0, min(stride*h.height, 1<<16))
+	scanline := make([]byte, 4*h.width)
+
+	for row := 0; row < h.height; row++ {
+		if err := readScanline(br, scanline, h.width); err != nil {
+			return nil, err
+		}
+
+		for x := 0; x < h.width; x++ {
+			p := scanline[4*x : 4*x+4]
+			c := rgbeToFloat(p[0], p[1], p[2], p[3])
+			pix = append(pix, c.R, c.G, c.B, c.A)
+		}
+	}
+
+	if h.flipped {
+		row := make([]float32, stride)
+		for top, bottom := 0, h.height-1; top < bottom; top, bottom = top+1, bottom-1 {
+			copy(row, pix[top*stride:(top+1)*stride])
+			copy(pix[top*stride:(top+1)*stride], pix[bottom*stride:(bottom+1)*stride])
+			copy(pix[bottom*stride:(bottom+1)*stride], row)
+		}
+	}
+
+	return &ImageF32{Pix: pix, Stride: stride, Rect: image.Rect(0, 0, h.width, h.height)}, nil
+}
+
+func rgbeToFloat(r, g, b, e byte) ColorF32 {
+	if e == 0 {
+		return ColorF32{0, 0, 0, 1}
+	}
+
+	f := float32(math.Ldexp(1.0, int(e)-(128+8)))
+	return ColorF32{(float32(r) + 0.5) * f, (float32(g) + 0.5) * f, (float32(b) + 0.5) * f, 1}
+}
+
+// readScanline reads one scanline of RGBE pixels, handling flat, old style
+// run-length and new style per-channel run-length encoded data.
+func readScanline(r *bufio.Reader, scanline []byte, width int) error {
+	start := make([]byte, 4)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return fmt.Errorf("hdr: %v", err)
+	}
+
+	if width < 8 || width > 0x7fff || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		copy(scanline, start)
+		return readOldScanline(r, scanline, width)
+	}
+
+	if int(start[2])<<8|int(start[3]) != width {
+		return fmt.Errorf("hdr: scanline width mismatch")
+	}
+
+	for c := 0; c < 4; c++ {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return fmt.Errorf("hdr: %v", err)
+			}
+
+			if count > 128 {
+				n := int(count - 128)
+				if x+n > width {
+					return fmt.Errorf("hdr: run exceeds scanline")
+				}
+				v, err := r.ReadByte()
+				if err != nil {
+					return fmt.Errorf("hdr: %v", err)
+				}
+				for ; n > 0; n-- {
+					scanline[4*x+c] = v
+					x++
+				}
+			} else {
+				n := int(count)
+				if n == 0 || x+n > width {
+					return fmt.Errorf("hdr: invalid run length")
+				}
+				for ; n > 0; n-- {
+					v, err := r.ReadByte()
+					if err != nil {
+						return fmt.Errorf("hdr: %v", err)
+					}
+					scanline[4*x+c] = v
+					x++
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// readOldScanline expects the first pixel to already be in scanline.
+func readOldScanline(r *bufio.Reader, scanline []byte, width int) error {
+	shift := 0
+	for x := 0; x < width; {
+		p := scanline[4*x : 4*x+4]
+		if x > 0 {
+			if _, err := io.ReadFull(r, p); err != nil {
+				return fmt.Errorf("hdr: %v", err)
+			}
+		}
+
+		if p[0] == 1 && p[1] == 1 && p[2] == 1 {
+			if x == 0 {
+				return fmt.Errorf("hdr: run without previous pixel")
+			}
+			n := int(p[3]) << shift
+			if x+n > width {
+				return fmt.Errorf("hdr: run exceeds scanline")
+			}
+			for ; n > 0; n-- {
+				copy(scanline[4*x:4*x+4], scanline[4*x-4:4*x])
+				x++
+			}
+			shift += 8
+			continue
+		}
+
+		shift = 0
+		x++
+	}
+
+	return nil
+}
+
+// ToneMap scales linear values by the exposure in stops and clips the
+// result to [0, 1].
+func ToneMap(img image.Image, exposure float64) image.Image {
+	bounds := img.Bounds()
+	scale := math.Exp2(exposure)
+	dst := image.NewRGBA64(bounds)
+
+	clip := func(v float64) uint16 {
+		return uint16(math.Max(0, math.Min(v*scale, 1)) * 0xffff)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := FloatRGBA(img.At(x, y))
+			dst.SetRGBA64(x, y, color.RGBA64{clip(r), clip(g), clip(b), 0xffff})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,151 @@
+package shared
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type TestCase struct {
+	Comparison Comparison
+	Failures   []string
+	Errors     []string
+	Skipped    bool
+	Seconds    float64
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Error      *junitFailure   `xml:"error,omitempty"`
+	Skipped    *junitSkipped   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Name identifies the compared pair, the output location when exported.
+func (c Comparison) Name() string {
+	if len(c.Location) > 0 {
+		return filepath.ToSlash(c.Location)
+	}
+	return c.SourceA + " vs " + c.SourceB
+}
+
+// ImagePaths returns the diff and visualization images of the comparison.
+func (c Comparison) ImagePaths() []string {
+	dir := c.Dir
+	if len(dir) == 0 {
+		dir = c.Location
+	}
+	if len(dir) == 0 {
+		return nil
+	}
+
+	paths := []string{}
+	for _, r := range c.Results {
+		paths = append(paths, filepath.Join(dir, r.ImageName()))
+	}
+	for _, v := range c.Visualizations {
+		paths = append(paths, filepath.Join(dir, v))
+	}
+	return paths
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
+
+func WriteJUnit(path string, suiteName string, cases []TestCase) error {
+	suite := junitSuite{Name: suiteName, Tests: len(cases)}
+
+	total := 0.0
+	for _, tc := range cases {
+		c := tc.Comparison
+		jc := junitCase{
+			Name:      c.Name(),
+			ClassName: suiteName,
+			Time:      formatSeconds(tc.Seconds),
+		}
+		total += tc.Seconds
+
+		for _, r := range c.Results {
+			jc.Properties = append(jc.Properties,
+				junitProperty{Name: r.Comparison + ".index", Value: strconv.FormatFloat(r.Index, 'g', -1, 64)},
+				junitProperty{Name: r.Comparison + ".numfailed", Value: strconv.Itoa(r.NumFailed)},
+			)
+		}
+
+		if len(tc.Failures) > 0 {
+			suite.Failures++
+			jc.Failure = &junitFailure{
+				Message: strings.Join(tc.Failures, "; "),
+				Type:    "threshold",
+				Text:    strings.Join(tc.Failures, "\n"),
+			}
+		}
+
+		if len(tc.Errors) > 0 {
+			suite.Errors++
+			jc.Error = &junitFailure{
+				Message: strings.Join(tc.Errors, "; "),
+				Type:    "error",
+				Text:    strings.Join(tc.Errors, "\n"),
+			}
+		}
+
+		if tc.Skipped {
+			suite.Skipped++
+			jc.Skipped = &junitSkipped{Message: "unfinished"}
+		}
+
+		jc.SystemOut = strings.Join(c.ImagePaths(), "\n")
+		suite.Cases = append(suite.Cases, jc)
+	}
+	suite.Time = formatSeconds(total)
+
+	data, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling junit xml: %v", err)
+	}
+
+	data = append([]byte(xml.Header), data...)
+	if err := WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+
+	return nil
+}
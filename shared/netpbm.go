@@ -0,0 +1,454 @@
+package shared
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	image.RegisterFormat("pbm", "P1", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pbm", "P4", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pgm", "P2", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pgm", "P5", decodePNM, decodePNMConfig)
+	image.RegisterFormat("ppm", "P3", decodePNM, decodePNMConfig)
+	image.RegisterFormat("ppm", "P6", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pam", "P7", decodePNM, decodePNMConfig)
+}
+
+type pnmHeader struct {
+	magic  string
+	width  int
+	height int
+	depth  int
+	maxval int
+}
+
+func (h pnmHeader) colorModel() color.Model {
+	switch {
+	case h.depth == 1 && h.maxval > 255:
+		return color.Gray16Model
+	case h.depth == 1:
+		return color.GrayModel
+	case h.depth == 3 && h.maxval > 255:
+		return color.RGBA64Model
+	case h.depth == 3:
+		return color.RGBAModel
+	case h.maxval > 255:
+		return color.NRGBA64Model
+	default:
+		return color.NRGBAModel
+	}
+}
+
+// readToken skips whitespace and comments and returns the next header token.
+// The single whitespace character terminating the token is consumed.
+func readToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+
+		if c == '#' && len(token) == 0 {
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if isSpace(c) {
+			if len(token) > 0 {
+				return string(token), nil
+			}
+			continue
+		}
+
+		token = append(token, c)
+	}
+}
+
+func readInt(r *bufio.Reader) (int, error) {
+	token, err := readToken(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(token)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func readPNMHeader(r *bufio.Reader) (pnmHeader, error) {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return pnmHeader{}, err
+	}
+
+	h := pnmHeader{magic: string(magic)}
+	if h.magic == "P7" {
+		return readPAMHeader(r, h)
+	}
+
+	var err error
+	if h.width, err = readInt(r); err != nil {
+		return h, fmt.Errorf("netpbm: invalid width: %v", err)
+	}
+	if h.height, err = readInt(r); err != nil {
+		return h, fmt.Errorf("netpbm: invalid height: %v", err)
+	}
+
+	switch h.magic {
+	case "P1", "P4":
+		h.depth, h.maxval = 1, 1
+	case "P2", "P5", "P3", "P6":
+		if h.maxval, err = readInt(r); err != nil {
+			return h, fmt.Errorf("netpbm: invalid maxval: %v", err)
+		}
+		h.depth = 1
+		if h.magic == "P3" || h.magic == "P6" {
+			h.depth = 3
+		}
+	default:
+		return h, fmt.Errorf("netpbm: unknown magic %q", h.magic)
+	}
+
+	return h, h.validate()
+}
+
+func readPAMHeader(r *bufio.Reader, h pnmHeader) (pnmHeader, error) {
+	tupleType := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return h, fmt.Errorf("netpbm: unterminated PAM header: %v", err)
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if len(fields) < 2 {
+			return h, fmt.Errorf("netpbm: malformed PAM header line %q", strings.TrimSpace(line))
+		}
+
+		switch fields[0] {
+		case "WIDTH":
+			h.width, err = strconv.Atoi(fields[1])
+		case "HEIGHT":
+			h.height, err = strconv.Atoi(fields[1])
+		case "DEPTH":
+			h.depth, err = strconv.Atoi(fields[1])
+		case "MAXVAL":
+			h.maxval, err = strconv.Atoi(fields[1])
+		case "TUPLTYPE":
+			tupleType = strings.Join(fields[1:], " ")
+		}
+		if err != nil {
+			return h, fmt.Errorf("netpbm: invalid %s: %v", fields[0], err)
+		}
+	}
+
+	if h.depth < 1 || h.depth > 4 {
+		return h, fmt.Errorf("netpbm: unsupported PAM depth %d (tuple type %q)", h.depth, tupleType)
+	}
+
+	return h, h.validate()
+}
+
+// maxPixels caps the dimensions the decoders accept, headers are checked
+// against it before any pixel buffer is allocated.
+const maxPixels = 1 << 28
+
+// validDimensions reports whether a width x height image is not empty and
+// within maxPixels.
+func validDimensions(width, height int) bool {
+	return width > 0 && height > 0 && width <= maxPixels/height
+}
+
+func (h pnmHeader) validate() error {
+	if !validDimensions(h.width, h.height) {
+		return fmt.Errorf("netpbm: invalid dimensions %d x %d", h.width, h.height)
+	}
+	if h.maxval < 1 || h.maxval > 0xffff {
+		return fmt.Errorf("netpbm: invalid maxval %d", h.maxval)
+	}
+	return nil
+}
+
+func decodePNMConfig(r io.Reader) (image.Config, error) {
+	h, err := readPNMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+func decodePNM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	h, err := readPNMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := readSamples(br, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return pnmImage(h, samples), nil
+}
+
+// readBytes reads n bytes like io.ReadFull, but the buffer grows with the
+// input so a truncated file fails before the full size is allocated.
+func readBytes(r io.Reader, n int) ([]byte, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err == nil && len(buf) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
+
+// readSamples reads the samples of all pixels. Plain formats append them as
+// they are parsed for the same reason as readBytes.
+func readSamples(r *bufio.Reader, h pnmHeader) ([]uint16, error) {
+	n := h.width * h.height * h.depth
+
+	switch h.magic {
+	case "P1":
+		samples := make([]uint16, 0, min(n, 1<<16))
+		for len(samples) < n {
+			var c byte
+			var err error
+			for {
+				if c, err = r.ReadByte(); err != nil {
+					return nil, fmt.Errorf("netpbm: %v", err)
+				}
+				if c == '#' {
+					r.ReadString('\n')
+					continue
+				}
+				if !isSpace(c) {
+					break
+				}
+			}
+			if c != '0' && c != '1' {
+				return nil, fmt.Errorf("netpbm: invalid PBM sample %q", c)
+			}
+			// PBM stores 1 as black.
+			samples = append(samples, uint16('1'-c))
+		}
+		return samples, nil
+	case "P4":
+		stride := (h.width + 7) / 8
+		data, err := readBytes(r, stride*h.height)
+		if err != nil {
+			return nil, fmt.Errorf("netpbm: %v", err)
+		}
+		samples := make([]uint16, n)
+		for y := 0; y < h.height; y++ {
+			row := data[y*stride : (y+1)*stride]
+			for x := 0; x < h.width; x++ {
+				bit := row[x/8] >> (7 - uint(x%8)) & 1
+				samples[y*h.width+x] = uint16(1 - bit)
+			}
+		}
+		return samples, nil
+	case "P2", "P3":
+		samples := make([]uint16, 0, min(n, 1<<16))
+		for len(samples) < n {
+			v, err := readInt(r)
+			if err != nil {
+				return nil, fmt.Errorf("netpbm: invalid sample: %v", err)
+			}
+			if v < 0 || v > h.maxval {
+				return nil, fmt.Errorf("netpbm: sample %d exceeds maxval %d", v, h.maxval)
+			}
+			samples = append(samples, uint16(v))
+		}
+		return samples, nil
+	default:
+		size := 1
+		if h.maxval > 255 {
+			size = 2
+		}
+		buf, err := readBytes(r, n*size)
+		if err != nil {
+			return nil, fmt.Errorf("netpbm: %v", err)
+		}
+		samples := make([]uint16, n)
+		for i := range samples {
+			if size == 2 {
+				samples[i] = uint16(buf[2*i])<<8 | uint16(buf[2*i+1])
+			} else {
+				samples[i] = uint16(buf[i])
+			}
+		}
+		return samples, nil
+	}
+}
+
+func pnmImage(h pnmHeader, samples []uint16) image.Image {
+	rect := image.Rect(0, 0, h.width, h.height)
+	wide := h.maxval > 255
+
+	scale8 := func(v uint16) uint8 {
+		return uint8((uint32(v)*255 + uint32(h.maxval)/2) / uint32(h.maxval))
+	}
+	scale16 := func(v uint16) uint16 {
+		return uint16((uint32(v)*0xffff + uint32(h.maxval)/2) / uint32(h.maxval))
+	}
+
+	switch {
+	case h.depth == 1 && wide:
+		img := image.NewGray16(rect)
+		for i, v := range samples {
+			s := scale16(v)
+			img.Pix[2*i], img.Pix[2*i+1] = uint8(s>>8), uint8(s)
+		}
+		return img
+	case h.depth == 1:
+		img := image.NewGray(rect)
+		for i, v := range samples {
+			img.Pix[i] = scale8(v)
+		}
+		return img
+	}
+
+	// Expand gray-alpha and RGB tuples to four channels.
+	rgba := func(i int) (r, g, b, a uint16) {
+		t := samples[i*h.depth : (i+1)*h.depth]
+		switch h.depth {
+		case 2:
+			return t[0], t[0], t[0], t[1]
+		case 3:
+			return t[0], t[1], t[2], uint16(h.maxval)
+		default:
+			return t[0], t[1], t[2], t[3]
+		}
+	}
+
+	// Opaque RGB tuples can use the premultiplied image types.
+	var pix []uint8
+	var img image.Image
+	switch {
+	case h.depth == 3 && wide:
+		p := image.NewRGBA64(rect)
+		pix, img = p.Pix, p
+	case h.depth == 3:
+		p := image.NewRGBA(rect)
+		pix, img = p.Pix, p
+	case wide:
+		p := image.NewNRGBA64(rect)
+		pix, img = p.Pix, p
+	default:
+		p := image.NewNRGBA(rect)
+		pix, img = p.Pix, p
+	}
+
+	for i := 0; i < h.width*h.height; i++ {
+		r, g, b, a := rgba(i)
+		if wide {
+			putUint16s(pix[8*i:], scale16(r), scale16(g), scale16(b), scale16(a))
+		} else {
+			pix[4*i], pix[4*i+1], pix[4*i+2], pix[4*i+3] = scale8(r), scale8(g), scale8(b), scale8(a)
+		}
+	}
+
+	return img
+}
+
+func putUint16s(pix []uint8, values ...uint16) {
+	for i, v := range values {
+		pix[2*i], pix[2*i+1] = uint8(v>>8), uint8(v)
+	}
+}
+
+// EncodePGM writes img as a binary graymap, 16 bits per sample when the
+// source has more than 8 bits.
+func EncodePGM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	wide := BitDepth(img) > 8
+
+	maxval := 255
+	if wide {
+		maxval = 0xffff
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P5\n%d %d\n%d\n", bounds.Dx(), bounds.Dy(), maxval)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y
+			if wide {
+				bw.Write([]byte{uint8(v >> 8), uint8(v)})
+			} else {
+				bw.WriteByte(uint8(v >> 8))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// EncodePPM writes img as a binary pixmap, 16 bits per sample when the
+// source has more than 8 bits.
+func EncodePPM(w io.Writer, img image.Image) error {
+	return encodePixmap(w, img, false)
+}
+
+// EncodePAM writes img as an RGB_ALPHA arbitrary map, 16 bits per sample
+// when the source has more than 8 bits.
+func EncodePAM(w io.Writer, img image.Image) error {
+	return encodePixmap(w, img, true)
+}
+
+func encodePixmap(w io.Writer, img image.Image, alpha bool) error {
+	bounds := img.Bounds()
+	wide := BitDepth(img) > 8
+
+	maxval := 255
+	if wide {
+		maxval = 0xffff
+	}
+
+	bw := bufio.NewWriter(w)
+	if alpha {
+		fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH 4\nMAXVAL %d\nTUPLTYPE RGB_ALPHA\nENDHDR\n", bounds.Dx(), bounds.Dy(), maxval)
+	} else {
+		fmt.Fprintf(bw, "P6\n%d %d\n%d\n", bounds.Dx(), bounds.Dy(), maxval)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			values := []uint16{c.R, c.G, c.B}
+			if alpha {
+				values = append(values, c.A)
+			}
+			for _, v := range values {
+				if wide {
+					bw.Write([]byte{uint8(v >> 8), uint8(v)})
+				} else {
+					bw.WriteByte(uint8(v >> 8))
+				}
+			}
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+)
+
+func init() {
+	image.RegisterFormat("pfm", "PF", decodePFM, decodePFMConfig)
+	image.RegisterFormat("pfm", "Pf", decodePFM, decodePFMConfig)
+}
+
+type pfmHeader struct {
+	channels int
+	width    int
+	height   int
+	order    binary.ByteOrder
+}
+
+func readPFMHeader(r *bufio.Reader) (pfmHeader, error) {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return pfmHeader{}, err
+	}
+
+	h := pfmHeader{}
+	switch string(magic) {
+	case "PF":
+		h.channels = 3
+	case "Pf":
+		h.channels = 1
+	default:
+		return h, fmt.Errorf("pfm: unknown magic %q", magic)
+	}
+
+	var err error
+	if h.width, err = readInt(r); err != nil {
+		return h, fmt.Errorf("pfm: invalid width: %v", err)
+	}
+	if h.height, err = readInt(r); err != nil {
+		return h, fmt.Errorf("pfm: invalid height: %v", err)
+	}
+	if !validDimensions(h.width, h.height) {
+		return h, fmt.Errorf("pfm: invalid dimensions %d x %d", h.width, h.height)
+	}
+
+	token, err := readToken(r)
+	if err != nil {
+		return h, fmt.Errorf("pfm: missing scale: %v", err)
+	}
+	scale, err := strconv.ParseFloat(token, 64)
+	if err != nil || scale == 0 {
+		return h, fmt.Errorf("pfm: invalid scale %q", token)
+	}
+
+	// A negative scale marks little-endian data.
+	h.order = binary.BigEndian
+	if scale < 0 {
+		h.order = binary.LittleEndian
+	}
+
+	return h, nil
+}
+
+func decodePFMConfig(r io.Reader) (image.Config, error) {
+	h, err := readPFMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{ColorModel: ColorF32Model, Width: h.width, Height: h.height}, nil
+}
+
+func decodePFM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	h, err := readPFMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	stride := 4 * h.channels * h.width
+	data, err := readBytes(br, stride*h.height)
+	if err != nil {
+		return nil, fmt.Errorf("pfm: %v", err)
+	}
+	img := NewImageF32(image.Rect(0, 0, h.width, h.height))
+
+	// Rows are stored bottom to top.
+	for y := h.height - 1; y >= 0; y-- {
+		row := data[(h.height-1-y)*stride:]
+
+		for x := 0; x < h.width; x++ {
+			var c ColorF32
+			sample := func(i int) float32 {
+				return math.Float32frombits(h.order.Uint32(row[4*(x*h.channels+i):]))
+			}
+			if h.channels == 3 {
+				c = ColorF32{sample(0), sample(1), sample(2), 1}
+			} else {
+				v := sample(0)
+				c = ColorF32{v, v, v, 1}
+			}
+			img.SetF32(x, y, c)
+		}
+	}
+
+	return img, nil
+}
+
+// EncodePFM writes img as a little-endian color PFM. Alpha is discarded.
+func EncodePFM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", bounds.Dx(), bounds.Dy())
+
+	buf := make([]byte, 4)
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := FloatRGBA(img.At(x, y))
+			for _, v := range []float64{r, g, b} {
+				binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(v)))
+				bw.Write(buf)
+			}
+		}
+	}
+
+	return bw.Flush()
+}
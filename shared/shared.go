@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"golang.org/x/image/draw"
 )
@@ -20,19 +22,73 @@ const (
 	Quad     ComparisonType = "quad"
 	SSIM     ComparisonType = "ssim"
 	MSE      ComparisonType = "mse"
+	Relative ComparisonType = "relative"
 )
 
+// SchemaVersion is the meta.json schema written by this version, files
+// without a schema_version are version 1.
+const SchemaVersion = 2
+
+// Version of the tools, set at build time with
+// -ldflags "-X ic/shared.Version=<version>".
+var Version = "dev"
+
 type Comparison struct {
-	Location string       `json:"location"`
-	SourceA  string       `json:"source_a"`
-	SourceB  string       `json:"source_b"`
-	Results  []ResultData `json:"results"`
+	SchemaVersion  int          `json:"schema_version"`
+	Tool           string       `json:"tool,omitempty"`
+	ToolVersion    string       `json:"tool_version,omitempty"`
+	Timestamp      string       `json:"timestamp,omitempty"`
+	Location       string       `json:"location"`
+	SourceA        string       `json:"source_a"`
+	SourceB        string       `json:"source_b"`
+	SourceAPath    string       `json:"source_a_path,omitempty"`
+	SourceBPath    string       `json:"source_b_path,omitempty"`
+	SourceAHash    string       `json:"source_a_sha256,omitempty"`
+	SourceBHash    string       `json:"source_b_sha256,omitempty"`
+	Config         string       `json:"config,omitempty"`
+	SourceAInfo    ImageInfo    `json:"source_a_info"`
+	SourceBInfo    ImageInfo    `json:"source_b_info"`
+	Results        []ResultData `json:"results"`
+	Visualizations []string     `json:"visualizations,omitempty"`
+	Passed         bool         `json:"passed"`
+	Reasons        []string     `json:"reasons,omitempty"`
+	Errors         []string     `json:"errors,omitempty"`
+
+	// OnlyIn is A or B for a file or directory that only exists on that
+	// side, the comparison then has no results.
+	OnlyIn string `json:"only_in,omitempty"`
+
+	// Dir is the directory the meta.json was read from.
+	Dir string `json:"-"`
 }
 
 type ResultData struct {
 	Comparison string  `json:"comparison"`
 	Index      float64 `json:"index"`
 	NumFailed  int     `json:"numfailed"`
+	Region     int     `json:"region,omitempty"`
+	Image      string  `json:"image,omitempty"`
+
+	Params  map[string]float64 `json:"params,omitempty"`
+	Seconds float64            `json:"seconds,omitempty"`
+}
+
+// NewComparison starts a comparison record of the current schema written by
+// tool.
+func NewComparison(tool string) Comparison {
+	return Comparison{
+		SchemaVersion: SchemaVersion,
+		Tool:          tool,
+		ToolVersion:   Version,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func (r ResultData) ImageName() string {
+	if len(r.Image) > 0 {
+		return r.Image
+	}
+	return r.Comparison + ".png"
 }
 
 func GetComparisons(compString string) []ComparisonType {
@@ -54,37 +110,102 @@ func GetComparisons(compString string) []ComparisonType {
 				comparisons = append(comparisons, SSIM)
 			case MSE:
 				comparisons = append(comparisons, MSE)
+			case Relative:
+				comparisons = append(comparisons, Relative)
 			}
 		}
 	}
 
 	return comparisons
 }
+
+type LoadOptions struct {
+	IgnoreOrientation bool
+}
+
 func LoadImage(path string) (image.Image, error) {
-	return loadImage(path, 1.0)
+	img, _, err := loadImage(path, 1.0, LoadOptions{})
+	return img, err
 }
 
 func LoadImageScaled(path string, scale float64) (image.Image, error) {
-	return loadImage(path, scale)
+	img, _, err := loadImage(path, scale, LoadOptions{})
+	return img, err
+}
+
+func LoadImageInfo(path string, opts LoadOptions) (image.Image, ImageInfo, error) {
+	return loadImage(path, 1.0, opts)
 }
 
-func loadImage(path string, scale float64) (image.Image, error) {
-	f, err := os.Open(path)
+func loadImage(path string, scale float64, opts LoadOptions) (image.Image, ImageInfo, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, ImageInfo{}, err
 	}
-	defer f.Close()
 
-	img, _, err := image.Decode(f)
+	img, info, err := DecodeImage(data, opts)
 	if err != nil {
-		return nil, err
+		return nil, ImageInfo{}, fmt.Errorf("%s: %v", path, err)
 	}
 
 	if scale != 1.0 {
 		img = scaleImage(img, scale)
 	}
 
-	return img, nil
+	return img, info, nil
+}
+
+// DecodeImage decodes an encoded image held in memory and applies its
+// orientation unless disabled.
+func DecodeImage(data []byte, opts LoadOptions) (image.Image, ImageInfo, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ImageInfo{}, err
+	}
+
+	info := ImageInfo{Format: format, BitDepth: BitDepth(img)}
+
+	info.Orientation = readOrientation(data, format)
+	if !opts.IgnoreOrientation {
+		img = applyOrientation(img, info.Orientation)
+	}
+	info.Width, info.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	return img, info, nil
+}
+
+// ReadImageInfo reads the dimensions and info of an image without decoding
+// its pixels, the dimensions take the orientation into account.
+func ReadImageInfo(path string, opts LoadOptions) (image.Config, ImageInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return image.Config{}, ImageInfo{}, err
+	}
+
+	cfg, info, err := DecodeImageInfo(data, opts)
+	if err != nil {
+		return image.Config{}, ImageInfo{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return cfg, info, nil
+}
+
+// DecodeImageInfo is ReadImageInfo for an encoded image held in memory.
+func DecodeImageInfo(data []byte, opts LoadOptions) (image.Config, ImageInfo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Config{}, ImageInfo{}, err
+	}
+
+	info := ImageInfo{Format: format, BitDepth: modelBitDepth(cfg.ColorModel)}
+
+	info.Orientation = readOrientation(data, format)
+	if !opts.IgnoreOrientation && info.Orientation >= 5 {
+		cfg.Width, cfg.Height = cfg.Height, cfg.Width
+	}
+	info.Width, info.Height = cfg.Width, cfg.Height
+
+	return cfg, info, nil
 }
 
 func scaleImage(img image.Image, scale float64) image.Image {
@@ -92,14 +213,87 @@ func scaleImage(img image.Image, scale float64) image.Image {
 	w := float64(bounds.Max.X) * scale
 	h := float64(bounds.Max.Y) * scale
 
-	dst := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	var dst draw.Image
+	if BitDepth(img) > 8 {
+		dst = image.NewRGBA64(image.Rect(0, 0, int(w), int(h)))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	}
 
 	draw.NearestNeighbor.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
 
 	return dst
 }
 
+// ReadMetaFile reads a single meta.json and sets Dir to its directory.
+// Files of older schema versions are migrated to the current one.
+func ReadMetaFile(path string) (Comparison, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Comparison{}, fmt.Errorf("error reading file: %v", err)
+	}
+
+	r, err := parseMeta(data)
+	if err != nil {
+		return r, fmt.Errorf("%s: %v", path, err)
+	}
+	r.Dir = filepath.Dir(path)
+
+	return r, nil
+}
+
+// parseMeta decodes a meta.json and migrates older schema versions to the
+// current one. Version 1 didn't store dimensions, they are left at 0 rather
+// than reading every source copy.
+func parseMeta(data []byte) (Comparison, error) {
+	var r Comparison
+
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return r, fmt.Errorf("error unmarshalling json: %v", err)
+	}
+
+	version := max(r.SchemaVersion, 1)
+	if version > SchemaVersion {
+		return r, fmt.Errorf("schema version %d is newer than the supported version %d", version, SchemaVersion)
+	}
+
+	if version < 2 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return r, fmt.Errorf("error unmarshalling json: %v", err)
+		}
+
+		// Without thresholds every comparison that ran passed.
+		if _, ok := fields["passed"]; !ok {
+			r.Passed = len(r.Errors) == 0
+		}
+
+		if r.Results == nil {
+			r.Results = []ResultData{}
+		}
+		for i := range r.Results {
+			r.Results[i].Image = r.Results[i].ImageName()
+		}
+
+		r.SchemaVersion = SchemaVersion
+	}
+
+	return r, nil
+}
+
 func FindMetaFiles(dir string) []Comparison {
+	comparisons, err := ReadMetaFiles(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return comparisons
+}
+
+// ReadMetaFiles reads every meta.json below dir, it returns the first error
+// instead of exiting.
+func ReadMetaFiles(dir string) ([]Comparison, error) {
 	comparisons := []Comparison{}
 
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -108,16 +302,9 @@ func FindMetaFiles(dir string) []Comparison {
 		}
 
 		if !info.IsDir() && filepath.Base(path) == "meta.json" {
-			var r Comparison
-
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("error reading file: %v", err)
-			}
-
-			err = json.Unmarshal(data, &r)
+			r, err := ReadMetaFile(path)
 			if err != nil {
-				return fmt.Errorf("error unmarshalling json: %v", err)
+				return err
 			}
 
 			comparisons = append(comparisons, r)
@@ -126,9 +313,5 @@ func FindMetaFiles(dir string) []Comparison {
 		return nil
 	})
 
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return comparisons
+	return comparisons, err
 }
@@ -0,0 +1,147 @@
+package shared
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadMetaFileV1(t *testing.T) {
+	dir := t.TempDir()
+
+	meta := `{
+		"location": "results/quad",
+		"source_a": "quadA.png",
+		"source_b": "quadB.png",
+		"source_a_info": {"format": "png", "bit_depth": 8},
+		"source_b_info": {"format": "png", "bit_depth": 8},
+		"results": [{"comparison": "pixel", "index": 0.75, "numfailed": 4}]
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ReadMetaFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.SchemaVersion != SchemaVersion {
+		t.Errorf("schema version %d, expected %d", c.SchemaVersion, SchemaVersion)
+	}
+	if !c.Passed {
+		t.Error("version 1 comparison without thresholds did not pass")
+	}
+	if c.Results[0].Image != "pixel.png" {
+		t.Errorf("diff image %s, expected pixel.png", c.Results[0].Image)
+	}
+	if c.SourceAInfo.Width != 0 || c.SourceBInfo.Height != 0 {
+		t.Errorf("dimensions of a version 1 file were filled in: %+v %+v", c.SourceAInfo, c.SourceBInfo)
+	}
+}
+
+func TestReadMetaFileCurrent(t *testing.T) {
+	dir := t.TempDir()
+
+	c := NewComparison("test")
+	c.Results = []ResultData{{Comparison: "ssim", Index: 0.5, NumFailed: -1, Params: map[string]float64{"k1": 0.01}, Seconds: 0.25}}
+	c.SourceAInfo = ImageInfo{Format: "png", BitDepth: 8, Width: 4, Height: 2}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ReadMetaFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Tool != "test" || r.ToolVersion != Version || r.Timestamp != c.Timestamp || r.Passed {
+		t.Errorf("unexpected comparison %+v", r)
+	}
+	if r.Results[0].Params["k1"] != 0.01 || r.Results[0].Seconds != 0.25 || r.SourceAInfo.Width != 4 {
+		t.Errorf("unexpected result %+v", r.Results[0])
+	}
+
+	newer := []byte(`{"schema_version": 99, "results": []}`)
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMetaFile(filepath.Join(dir, "meta.json")); err == nil {
+		t.Error("expected an error for a newer schema version")
+	}
+}
+
+func TestDecodeOversized(t *testing.T) {
+	headers := []string{
+		"P6\n3037000500 3037000500\n255\n",
+		"P5\n65536 65536\n255\n",
+		"P7\nWIDTH 4294967296\nHEIGHT 4294967296\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n",
+		"PF\n3037000500 3037000500\n-1.0\n",
+		"Pf\n65536 65536\n-1.0\n",
+		"#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 3037000500 +X 3037000500\n",
+	}
+
+	for _, h := range headers {
+		if _, _, err := image.Decode(strings.NewReader(h)); err == nil {
+			t.Errorf("decoding %q succeeded", h)
+		}
+		if _, _, err := image.DecodeConfig(strings.NewReader(h)); err == nil {
+			t.Errorf("decoding the config of %q succeeded", h)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	// Headers within the pixel cap followed by a few bytes of data.
+	headers := []string{
+		"P7\nWIDTH 16384\nHEIGHT 16384\nDEPTH 4\nMAXVAL 65535\nTUPLTYPE RGB_ALPHA\nENDHDR\n",
+		"P6\n16384 16384\n255\n",
+		"P4\n16384 16384\n",
+		"P3\n16384 16384\n255\n",
+		"PF\n16384 16384\n-1.0\n",
+		"#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 16384 +X 16384\n",
+	}
+
+	for _, h := range headers {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		if _, _, err := image.Decode(strings.NewReader(h + "1 2 3 4 5 6 7 8")); err == nil {
+			t.Errorf("decoding truncated %q succeeded", h)
+		}
+
+		runtime.ReadMemStats(&after)
+		if n := after.TotalAlloc - before.TotalAlloc; n > 16<<20 {
+			t.Errorf("decoding truncated %q allocated %d bytes", h, n)
+		}
+	}
+}
+
+func TestWriteFileAtomicMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	if err := WriteFileAtomic(path, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Fatalf("new file does not have mode 0644 (%v)", err)
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("replaced file does not keep mode 0600 (%v)", err)
+	}
+}